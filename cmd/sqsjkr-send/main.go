@@ -0,0 +1,98 @@
+// sqsjkr-send sends the signed job message to SQS
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/kayac/sqsjkr"
+)
+
+var (
+	profile  string
+	region   string
+	endpoint string
+	queueURL string
+	keyID    string
+	groupID  string
+	dedupID  string
+)
+
+func main() {
+	flag.StringVar(&profile, "profile", "", "aws profile")
+	flag.StringVar(&region, "region", os.Getenv("AWS_REGION"), "aws region")
+	flag.StringVar(&endpoint, "endpoint", "", "SQS endpoint url")
+	flag.StringVar(&queueURL, "queue-url", "", "SQS queue url")
+	flag.StringVar(&keyID, "key-id", "", "signature key id (the key is read from SQSJKR_SIGNATURE_SECRET env)")
+	flag.StringVar(&groupID, "group-id", "", "message group id of FIFO queue")
+	flag.StringVar(&dedupID, "deduplication-id", "", "message deduplication id of FIFO queue")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [job.json]\n\nsends the job definition in job.json (default stdin).\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := send(flag.Arg(0)); err != nil {
+		log.Fatal("[error] ", err)
+	}
+}
+
+func send(path string) error {
+	if queueURL == "" {
+		return fmt.Errorf("-queue-url is required")
+	}
+
+	var body []byte
+	var err error
+	if path == "" || path == "-" {
+		body, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		body, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	awsConf := &aws.Config{
+		Region: aws.String(region),
+	}
+	if profile != "" {
+		awsConf.Credentials = credentials.NewSharedCredentials("", profile)
+	}
+	if endpoint != "" {
+		awsConf.Endpoint = aws.String(endpoint)
+	}
+	q := sqs.New(session.New(), awsConf)
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(body)),
+	}
+	if groupID != "" {
+		input.MessageGroupId = aws.String(groupID)
+	}
+	if dedupID != "" {
+		input.MessageDeduplicationId = aws.String(dedupID)
+	}
+	if keyID != "" {
+		secret := os.Getenv("SQSJKR_SIGNATURE_SECRET")
+		if secret == "" {
+			return fmt.Errorf("SQSJKR_SIGNATURE_SECRET env is required to sign the message")
+		}
+		sqsjkr.SignMessage(input, keyID, []byte(secret))
+	}
+
+	out, err := q.SendMessage(input)
+	if err != nil {
+		return err
+	}
+	fmt.Println(aws.StringValue(out.MessageId))
+	return nil
+}
@@ -25,6 +25,7 @@ var (
 	table       string
 	statsSock   string
 	statsPort   int
+	ddbEndpoint string
 )
 
 func main() {
@@ -36,6 +37,7 @@ func main() {
 	flag.StringVar(&table, "lock-table", "sqsjkr", "lock & throttle DynamoDB table name")
 	flag.StringVar(&statsSock, "stats-socket", "", "sqsjkr stats api socket path")
 	flag.IntVar(&statsPort, "stats-port", 0, "sqsjkr stats api port")
+	flag.StringVar(&ddbEndpoint, "dynamodb-endpoint", "", "DynamoDB endpoint url of lock & throttle table (overrides [dynamodb] endpoint)")
 	flag.Parse()
 
 	if showVersion {
@@ -79,6 +81,11 @@ func main() {
 		conf.Account.Region = region
 	}
 
+	// overwrite DynamoDB endpoint
+	if ddbEndpoint != "" {
+		conf.DynamoDB.Endpoint = ddbEndpoint
+	}
+
 	// init sqsjkr
 	sjkr, err := sqsjkr.New(conf)
 	if err != nil {
@@ -86,18 +93,20 @@ func main() {
 	}
 
 	// configure Locker
-	locker := lock.NewDynamodbLock(
+	locker := lock.NewDynamodbLockWithEndpoint(
 		conf.Account.Profile,
 		conf.Account.Region,
+		conf.DynamoDB.Endpoint,
 		table,
 	)
 	sjkr.SetLocker(locker)
 
 	// configure throttler
-	throttler := throttle.NewDynamodbThrottle(
+	throttler := throttle.NewDynamodbThrottleWithEndpoint(
 		ctx,
 		conf.Account.Profile,
 		conf.Account.Region,
+		conf.DynamoDB.Endpoint,
 		table,
 		sjkr.RetentionPeriod,
 	)
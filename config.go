@@ -2,15 +2,127 @@ package sqsjkr
 
 import (
 	"fmt"
+	"path"
+	"time"
 
 	"github.com/kayac/go-config"
 )
 
 // Config is the sqsjkr config
 type Config struct {
-	Account AccountSection `toml:"account"`
-	Kicker  KickerSection  `toml:"kicker"`
-	SQS     SQSSection     `toml:"sqs"`
+	Account    AccountSection         `toml:"account"`
+	Kicker     KickerSection          `toml:"kicker"`
+	SQS        SQSSection             `toml:"sqs"`
+	DeadLetter DeadLetterSection      `toml:"dead_letter"`
+	File       FileSection            `toml:"file"`
+	Payload    PayloadSection         `toml:"payload"`
+	DynamoDB   DynamoDBSection        `toml:"dynamodb"`
+	Signature  SignatureSection       `toml:"signature"`
+	Jobs       map[string]JobSection  `toml:"jobs"`
+	Sinks      map[string]SinkSection `toml:"sinks"`
+	History    HistorySection         `toml:"history"`
+	Metrics    MetricsSection         `toml:"metrics"`
+}
+
+// MetricsSection is the config of metrics
+type MetricsSection struct {
+	StatsD StatsDSection `toml:"statsd"`
+}
+
+// StatsDSection is the config of StatsD or DogStatsD to push metrics to
+type StatsDSection struct {
+	Address       string   `toml:"address"`
+	Prefix        string   `toml:"prefix"`
+	Format        string   `toml:"format"`
+	Tags          []string `toml:"tags"`
+	GaugeInterval Duration `toml:"gauge_interval"`
+}
+
+// HistorySection is the config of the local history of job runs
+type HistorySection struct {
+	Path    string   `toml:"path"`
+	MaxAge  Duration `toml:"max_age"`
+	MaxSize ByteSize `toml:"max_size"`
+}
+
+// SinkSection is the destination of job results. One of queue, topic,
+// webhook url and file is specified.
+type SinkSection struct {
+	QueueName string            `toml:"queue_name"`
+	QueueURL  string            `toml:"queue_url"`
+	TopicArn  string            `toml:"topic_arn"`
+	URL       string            `toml:"url"`
+	Headers   map[string]string `toml:"headers"`
+	Timeout   Duration          `toml:"timeout"`
+	File      string            `toml:"file"`
+}
+
+// destinations returns the number of destinations of the sink
+func (s SinkSection) destinations() int {
+	var n int
+	for _, d := range []string{s.QueueName + s.QueueURL, s.TopicArn, s.URL, s.File} {
+		if d != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// PayloadSection is the config of the object store of large payloads
+type PayloadSection struct {
+	Endpoint        string `toml:"endpoint"`
+	Directory       string `toml:"directory"`
+	DeleteOnSuccess bool   `toml:"delete_on_success"`
+}
+
+// DynamoDBSection is the config of DynamoDB of the lock and throttle table
+type DynamoDBSection struct {
+	Endpoint string `toml:"endpoint"`
+}
+
+// JobSection is the definition of the job which messages run by name
+type JobSection struct {
+	Command       string            `toml:"command"`
+	Args          []string          `toml:"args"`
+	Shell         string            `toml:"shell"`
+	Envs          map[string]string `toml:"envs"`
+	LifeTime      Duration          `toml:"life_time"`
+	LockID        string            `toml:"lock_id"`
+	AbortIfLocked bool              `toml:"abort_if_locked"`
+	Timeout       Duration          `toml:"timeout"`
+	Params        []string          `toml:"params"`
+	RetryPolicy
+	ProcessAttr
+	ResourceLimits
+}
+
+// allows reports whether the message can set the param
+func (j JobSection) allows(param string) bool {
+	return contains(j.Params, param)
+}
+
+// SignatureSection is the config of verification of message signatures
+type SignatureSection struct {
+	Required bool           `toml:"required"`
+	Keys     []SignatureKey `toml:"keys"`
+}
+
+// SignatureKey is the HMAC key to verify message signatures
+type SignatureKey struct {
+	ID     string `toml:"id"`
+	Secret string `toml:"secret"`
+}
+
+// keyRing returns KeyRing of the keys
+func (s SignatureSection) keyRing() KeyRing {
+	if len(s.Keys) == 0 {
+		return nil
+	}
+	kr := make(KeyRing, len(s.Keys))
+	for _, k := range s.Keys {
+		kr[k.ID] = []byte(k.Secret)
+	}
+	return kr
 }
 
 // AccountSection is aws account information
@@ -22,23 +134,113 @@ type AccountSection struct {
 
 // KickerSection is the config of command kicker
 type KickerSection struct {
-	MaxConcurrentNum int    `toml:"max_concurrent_num"`
-	Trigger          string `toml:"life_time_trigger"`
-	StatsPort        int    `toml:"stats_port"`
-	StatsSocket      string `toml:"stats_socket"`
+	MaxConcurrentNum    int      `toml:"max_concurrent_num"`
+	Trigger             string   `toml:"life_time_trigger"`
+	StatsPort           int      `toml:"stats_port"`
+	StatsSocket         string   `toml:"stats_socket"`
+	ShutdownGracePeriod Duration `toml:"shutdown_grace_period"`
+	KillTimeout         Duration `toml:"kill_timeout"`
+	StrictJobs          bool     `toml:"strict_jobs"`
+	Timeout             Duration `toml:"timeout"`
+	Shell               string   `toml:"shell"`
+	AllowedUsers        []string `toml:"allowed_users"`
+	AllowedGroups       []string `toml:"allowed_groups"`
+	AllowedWorkdirs     []string `toml:"allowed_workdirs"`
+	CgroupRoot          string   `toml:"cgroup_root"`
+	ResultSink          string   `toml:"result_sink"`
+	AllowedReplyQueues  []string `toml:"allowed_reply_queues"`
+	OutputHeadSize      ByteSize `toml:"output_head_size"`
+	OutputTailSize      ByteSize `toml:"output_tail_size"`
+	RetryPolicy
+	ResourceLimits
+}
+
+// killTimeout returns the duration to wait for jobs to exit after SIGTERM
+// before sending SIGKILL.
+func (k KickerSection) killTimeout() time.Duration {
+	if k.KillTimeout.Duration <= 0 {
+		return DefaultKillTimeout
+	}
+	return k.KillTimeout.Duration
 }
 
 // SQSSection is the AWS SQS configure
 type SQSSection struct {
+	QueueName         string         `toml:"queue_name"`
+	QueueURL          string         `toml:"queue_url"`
+	Endpoint          string         `toml:"endpoint"`
+	AtLeastOnce       bool           `toml:"at_least_once"`
+	VisibilityTimeout Duration       `toml:"visibility_timeout"`
+	HeartbeatInterval Duration       `toml:"heartbeat_interval"`
+	Queues            []QueueSection `toml:"queues"`
+}
+
+// QueueSection is the config of a queue when sqsjkr polls multiple queues
+type QueueSection struct {
+	Name             string `toml:"name"`
+	QueueURL         string `toml:"queue_url"`
+	Weight           int    `toml:"weight"`
+	MaxConcurrentNum int    `toml:"max_concurrent_num"`
+}
+
+// name returns the queue name, which is the last part of the url unless
+// the name is specified.
+func (q QueueSection) name() string {
+	if q.Name != "" {
+		return q.Name
+	}
+	return path.Base(q.QueueURL)
+}
+
+// queues returns the queues to poll
+func (s SQSSection) queues() []QueueSection {
+	if len(s.Queues) > 0 {
+		return s.Queues
+	}
+	return []QueueSection{{Name: s.QueueName, QueueURL: s.QueueURL}}
+}
+
+// visibilityTimeout returns the visibility timeout of received messages.
+func (s SQSSection) visibilityTimeout() time.Duration {
+	if s.VisibilityTimeout.Duration < time.Second {
+		return VisibilityTimeout * time.Second
+	}
+	return s.VisibilityTimeout.Duration
+}
+
+// heartbeatInterval returns the interval to extend visibility timeout of
+// messages of running jobs.
+func (s SQSSection) heartbeatInterval() time.Duration {
+	if s.HeartbeatInterval.Duration <= 0 {
+		return s.visibilityTimeout() / 3
+	}
+	return s.HeartbeatInterval.Duration
+}
+
+// DeadLetterSection is the destination of failed jobs
+type DeadLetterSection struct {
 	QueueName string `toml:"queue_name"`
+	QueueURL  string `toml:"queue_url"`
+	File      string `toml:"file"`
+}
+
+// FileSection is the JSON lines file to read messages from instead of SQS
+type FileSection struct {
+	Path string `toml:"path"`
 }
 
 // NewConfig create sqsjkr config
 func NewConfig() *Config {
 	return &Config{
-		Account: AccountSection{},
-		Kicker:  KickerSection{},
-		SQS:     SQSSection{},
+		Account:    AccountSection{},
+		Kicker:     KickerSection{},
+		SQS:        SQSSection{},
+		DeadLetter: DeadLetterSection{},
+		File:       FileSection{},
+		Payload:    PayloadSection{},
+		Signature:  SignatureSection{},
+		History:    HistorySection{},
+		Metrics:    MetricsSection{},
 	}
 }
 
@@ -54,6 +256,16 @@ func (c *Config) SetSQSQueue(qname string) {
 	c.SQS.QueueName = qname
 }
 
+// SetSQSQueueURL set sqs queue url
+func (c *Config) SetSQSQueueURL(qURL string) {
+	c.SQS.QueueURL = qURL
+}
+
+// SetSQSEndpoint set sqs endpoint url
+func (c *Config) SetSQSEndpoint(endpoint string) {
+	c.SQS.Endpoint = endpoint
+}
+
 // SetKickerConfig set kicker config
 func (c *Config) SetKickerConfig(num int, trigger string) {
 	c.Kicker.MaxConcurrentNum = num
@@ -105,16 +317,75 @@ func LoadConfig(path string) (*Config, error) {
 
 // Validate config validation
 func (c *Config) Validate() error {
-	if c.SQS.QueueName == "" {
-		return fmt.Errorf("queue_name is required")
+	if c.File.Path == "" {
+		names := map[string]bool{}
+		for _, q := range c.SQS.queues() {
+			if q.Name == "" && q.QueueURL == "" {
+				return fmt.Errorf("queue_name or queue_url is required")
+			}
+
+			if c.Account.ID == "" && q.QueueURL == "" {
+				return fmt.Errorf("aws account id is required")
+			}
+
+			if names[q.name()] {
+				return fmt.Errorf("queue %s is duplicated", q.name())
+			}
+			names[q.name()] = true
+		}
+
+		if c.Account.Region == "" {
+			return fmt.Errorf("aws region is required")
+		}
+	}
+
+	if c.SQS.HeartbeatInterval.Duration >= c.SQS.visibilityTimeout() {
+		return fmt.Errorf("heartbeat_interval must be shorter than visibility_timeout")
 	}
 
-	if c.Account.ID == "" {
-		return fmt.Errorf("aws account id is required")
+	if (c.DeadLetter.QueueName != "" || c.DeadLetter.QueueURL != "") && c.DeadLetter.File != "" {
+		return fmt.Errorf("could not specify both dead letter queue and file")
+	}
+
+	if c.Signature.Required && len(c.Signature.Keys) == 0 {
+		return fmt.Errorf("signature keys are required to verify signatures")
+	}
+	keyIDs := map[string]bool{}
+	for _, k := range c.Signature.Keys {
+		if k.ID == "" || k.Secret == "" {
+			return fmt.Errorf("id and secret of signature keys are required")
+		}
+		if keyIDs[k.ID] {
+			return fmt.Errorf("signature key %s is duplicated", k.ID)
+		}
+		keyIDs[k.ID] = true
+	}
+
+	for name, j := range c.Jobs {
+		if (j.Command == "") == (len(j.Args) == 0) {
+			return fmt.Errorf("either command or args of job %s is required", name)
+		}
+		if _, err := j.umask(); err != nil {
+			return fmt.Errorf("job %s has %s", name, err)
+		}
+	}
+	if c.Kicker.StrictJobs && len(c.Jobs) == 0 {
+		return fmt.Errorf("jobs are required in strict mode")
+	}
+
+	for name, s := range c.Sinks {
+		if s.destinations() != 1 {
+			return fmt.Errorf("sink %s must have one of queue, topic_arn, url and file", name)
+		}
+	}
+	if _, ok := c.Sinks[c.Kicker.ResultSink]; c.Kicker.ResultSink != "" && !ok {
+		return fmt.Errorf("result sink %s is not defined", c.Kicker.ResultSink)
 	}
 
-	if c.Account.Region == "" {
-		return fmt.Errorf("aws region is required")
+	switch c.Metrics.StatsD.Format {
+	case "", StatsDFormatDogStatsD, StatsDFormatStatsD:
+	default:
+		return fmt.Errorf("unknown statsd format %s", c.Metrics.StatsD.Format)
 	}
 
 	if c.Kicker.StatsPort != 0 && c.Kicker.StatsSocket != "" {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMain(m *testing.M) {
@@ -19,7 +20,12 @@ func TestLoadConfig(t *testing.T) {
 			Region:  "ap-northeast-1",
 		},
 		SQS: SQSSection{
-			QueueName: "test_queue",
+			QueueName:         "test_queue",
+			VisibilityTimeout: Duration{time.Minute},
+			HeartbeatInterval: Duration{20 * time.Second},
+		},
+		DynamoDB: DynamoDBSection{
+			Endpoint: "http://localhost:8000",
 		},
 		Kicker: KickerSection{
 			MaxConcurrentNum: 5,
@@ -38,6 +44,59 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestHeartbeatInterval(t *testing.T) {
+	c := NewConfig()
+	if got := c.SQS.visibilityTimeout(); got != VisibilityTimeout*time.Second {
+		t.Errorf("unexpected default visibility timeout: got=%s", got)
+	}
+	if got := c.SQS.heartbeatInterval(); got != 10*time.Second {
+		t.Errorf("unexpected default heartbeat interval: got=%s, expected=10s", got)
+	}
+
+	c.SetAWSAccount("123456789", "default", "ap-northeast-1")
+	c.SetSQSQueue("test_queue_name")
+	c.SQS.HeartbeatInterval = Duration{time.Minute}
+	if err := c.Validate(); err == nil {
+		t.Error("heartbeat_interval longer than visibility_timeout should be invalid")
+	}
+}
+
+func TestValidateQueueURL(t *testing.T) {
+	c := NewConfig()
+	c.Account.Region = "ap-northeast-1"
+	if err := c.Validate(); err == nil {
+		t.Error("queue_name or queue_url should be required")
+	}
+
+	c.SetSQSQueueURL("http://localhost:9324/queue/test_queue")
+	if err := c.Validate(); err != nil {
+		t.Errorf("queue_url without account id should be valid: %s", err)
+	}
+}
+
+func TestMultipleQueues(t *testing.T) {
+	conf, err := LoadConfig("./test/multiple_queues.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queues := conf.SQS.queues()
+	if len(queues) != 2 {
+		t.Fatalf("unexpected queues: %v", queues)
+	}
+	if queues[0].name() != "high_priority" || queues[0].Weight != 3 {
+		t.Errorf("unexpected queue: %v", queues[0])
+	}
+	if queues[1].name() != "batch" || queues[1].MaxConcurrentNum != 2 {
+		t.Errorf("unexpected queue: %v", queues[1])
+	}
+
+	conf.SQS.Queues[1].Name = "high_priority"
+	if err := conf.Validate(); err == nil {
+		t.Error("duplicated queue names should be invalid")
+	}
+}
+
 func TestUseSocketAndPort(t *testing.T) {
 	_, err := LoadConfig("./test/use_unix_domain_and_tcp.toml")
 	if err == nil {
@@ -6,11 +6,76 @@ import (
 
 // Default Const
 const (
-	DefaultMaxCocurrentNum = 20
-	VisibilityTimeout      = 30
-	WaitTimeSec            = 10
-	MaxRetrieveMessageNum  = 10
-	JobRetryInterval       = time.Second * 5
-	ApplicationJSON        = "application/json"
-	DefaultStatsPort       = 8061
+	DefaultMaxCocurrentNum     = 20
+	VisibilityTimeout          = 30
+	WaitTimeSec                = 10
+	SharedPollInterval         = time.Second
+	MaxRetrieveMessageNum      = 10
+	JobRetryInterval           = time.Second * 5
+	ApplicationJSON            = "application/json"
+	DefaultKillTimeout         = 10 * time.Second
+	DefaultShell               = "sh -c"
+	ShellNone                  = "none"
+	DefaultRetryBackoff        = 10 * time.Second
+	MaxRetryBackoff            = 12 * time.Hour // max visibility timeout of SQS
+	DefaultStatsPort           = 8061
+	DeadLetterOutputSize       = 4096
+	ResultOutputSize           = 16 * 1024
+	DefaultWebhookTimeout      = 10 * time.Second
+	HistoryOutputSize          = 4096
+	DefaultHistoryMaxAge       = 7 * 24 * time.Hour
+	DefaultHistoryMaxSize      = 64 * 1024 * 1024
+	HistoryCompactInterval     = time.Hour
+	DefaultHistoryLimit        = 100
+	DefaultStatsDPrefix        = "sqsjkr."
+	DefaultStatsDGaugeInterval = 10 * time.Second
+	DefaultOutputHeadSize      = 32 * 1024
+	DefaultOutputTailSize      = 32 * 1024
+	maxLogLineSize             = 16 * 1024
+	ReceiveBackoffBase         = time.Second
+	ReceiveBackoffMax          = time.Minute
+	DegradedFailureNum         = 3
+	StatusHealthy              = "healthy"
+	StatusDegraded             = "degraded"
+	DefaultQueueName           = "default"
 )
+
+// Outcomes of jobs
+const (
+	OutcomeSucceeded      = "succeeded"
+	OutcomeInvalidMessage = "invalid_message"
+	OutcomeFailed         = "failed"
+	OutcomeErrored        = "errored"
+	OutcomeTimedOut       = "timed_out"
+	OutcomeLimitExceeded  = "limit_exceeded"
+	OutcomeRejected       = "rejected"
+)
+
+// Attributes of FIFO queue messages
+const (
+	MessageGroupID         = "MessageGroupId"
+	MessageDeduplicationID = "MessageDeduplicationId"
+	SequenceNumber         = "SequenceNumber"
+)
+
+var fifoAttributes = []string{MessageGroupID, MessageDeduplicationID, SequenceNumber}
+
+// Metadata of SNS and EventBridge envelopes
+const (
+	MetadataTopicArn    = "TopicArn"
+	MetadataEventSource = "EventSource"
+	MetadataDetailType  = "DetailType"
+	MetadataRuleName    = "RuleName"
+)
+
+// metadataEnvs is the names of environment variables to pass metadata to
+// the command
+var metadataEnvs = []struct{ name, env string }{
+	{MessageGroupID, "SQSJKR_MESSAGE_GROUP_ID"},
+	{MessageDeduplicationID, "SQSJKR_MESSAGE_DEDUPLICATION_ID"},
+	{SequenceNumber, "SQSJKR_SEQUENCE_NUMBER"},
+	{MetadataTopicArn, "SQSJKR_SNS_TOPIC_ARN"},
+	{MetadataEventSource, "SQSJKR_EVENT_SOURCE"},
+	{MetadataDetailType, "SQSJKR_EVENT_DETAIL_TYPE"},
+	{MetadataRuleName, "SQSJKR_EVENT_RULE_NAME"},
+}
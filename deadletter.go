@@ -0,0 +1,134 @@
+package sqsjkr
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// DeadLetter is the record of a message which could not be executed
+// successfully.
+type DeadLetter struct {
+	MessageID       string    `json:"message_id"`
+	EventID         string    `json:"event_id,omitempty"`
+	Body            string    `json:"body"`
+	Outcome         string    `json:"outcome"`
+	Reason          string    `json:"reason"`
+	ExitCode        int       `json:"exit_code,omitempty"`
+	Output          string    `json:"output,omitempty"`
+	OutputTruncated bool      `json:"output_truncated,omitempty"`
+	Host            string    `json:"host"`
+	ReceiveCount    int64     `json:"receive_count"`
+	SentAt          time.Time `json:"sent_at"`
+	FailedAt        time.Time `json:"failed_at"`
+}
+
+// DeadLetterQueue is the destination of dead letters
+type DeadLetterQueue interface {
+	Send(*DeadLetter) error
+}
+
+// SQSDeadLetterQueue sends dead letters to the SQS queue
+type SQSDeadLetterQueue struct {
+	SQS  *sqs.SQS
+	qURL string
+}
+
+// NewSQSDeadLetterQueue build SQSDeadLetterQueue
+func NewSQSDeadLetterQueue(q *sqs.SQS, qURL string) *SQSDeadLetterQueue {
+	return &SQSDeadLetterQueue{
+		SQS:  q,
+		qURL: qURL,
+	}
+}
+
+// Send sends the dead letter as the message body
+func (dq *SQSDeadLetterQueue) Send(dl *DeadLetter) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	params := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(dq.qURL),
+		MessageBody: aws.String(string(b)),
+	}
+	_, err = dq.SQS.SendMessage(params)
+	return err
+}
+
+// FileDeadLetterQueue appends dead letters to the local file in JSON lines
+type FileDeadLetterQueue struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileDeadLetterQueue build FileDeadLetterQueue
+func NewFileDeadLetterQueue(path string) *FileDeadLetterQueue {
+	return &FileDeadLetterQueue{path: path}
+}
+
+// Send appends the dead letter to the file
+func (dq *FileDeadLetterQueue) Send(dl *DeadLetter) error {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	return appendJSONLine(dq.path, dl)
+}
+
+// appendJSONLine appends v in JSON to the file
+func appendJSONLine(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newDeadLetter build DeadLetter from the message
+func newDeadLetter(msg *Message, outcome string, reason error) *DeadLetter {
+	host, _ := os.Hostname()
+	dl := &DeadLetter{
+		Outcome:  outcome,
+		Reason:   reason.Error(),
+		Host:     host,
+		FailedAt: time.Now(),
+	}
+	if msg == nil {
+		return dl
+	}
+
+	dl.MessageID = msg.ID
+	dl.Body = msg.Body
+	dl.ReceiveCount = msg.ReceiveCount()
+	dl.SentAt, _ = msg.SentTimestamp()
+	return dl
+}
+
+// setOutput sets the tail of output and the exit code of the command.
+func (dl *DeadLetter) setOutput(output []byte, err error) {
+	if len(output) > DeadLetterOutputSize {
+		output = output[len(output)-DeadLetterOutputSize:]
+		dl.OutputTruncated = true
+	}
+	dl.Output = string(output)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		dl.ExitCode = exitErr.ExitCode()
+	}
+}
@@ -0,0 +1,61 @@
+package sqsjkr
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// envelope has the fields of SNS notifications and EventBridge events
+type envelope struct {
+	// SNS notification
+	Type     string `json:"Type"`
+	TopicArn string `json:"TopicArn"`
+	Message  string `json:"Message"`
+
+	// EventBridge event
+	Source     string          `json:"source"`
+	DetailType string          `json:"detail-type"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// unwrapEnvelope returns the job body in the SNS notification or the
+// EventBridge event, and metadata of the envelope. unwrapEnvelope returns
+// the payload as is if it is not an envelope.
+func unwrapEnvelope(payload string) (string, map[string]string) {
+	metadata := map[string]string{}
+	for {
+		var e envelope
+		if err := json.Unmarshal([]byte(payload), &e); err != nil {
+			return payload, metadata
+		}
+
+		switch {
+		case e.Type == "Notification" && e.TopicArn != "":
+			metadata[MetadataTopicArn] = e.TopicArn
+			payload = e.Message
+		case e.Source != "" && e.DetailType != "" && len(e.Detail) > 0:
+			metadata[MetadataEventSource] = e.Source
+			metadata[MetadataDetailType] = e.DetailType
+			if name := ruleName(e.Resources); name != "" {
+				metadata[MetadataRuleName] = name
+			}
+			payload = string(e.Detail)
+		default:
+			return payload, metadata
+		}
+	}
+}
+
+// ruleName returns the name of the EventBridge rule in resources
+// (e.g. arn:aws:events:ap-northeast-1:123456789012:rule/my-rule).
+func ruleName(resources []string) string {
+	for _, r := range resources {
+		if i := strings.Index(r, ":rule/"); i >= 0 {
+			name := r[i+len(":rule/"):]
+			// the rule of the custom event bus is rule/bus-name/rule-name
+			return name[strings.LastIndex(name, "/")+1:]
+		}
+	}
+	return ""
+}
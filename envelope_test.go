@@ -0,0 +1,67 @@
+package sqsjkr
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testEventBridgeEvent = `{
+  "version": "0",
+  "id": "6a7e8feb-b491-4cf7-a9f1-bf3703467718",
+  "detail-type": "job",
+  "source": "my.app",
+  "account": "123456789012",
+  "time": "2021-02-15T00:00:00Z",
+  "region": "ap-northeast-1",
+  "resources": ["arn:aws:events:ap-northeast-1:123456789012:rule/my-bus/nightly_batch"],
+  "detail": {"command": "echo $SQSJKR_EVENT_RULE_NAME $SQSJKR_SNS_TOPIC_ARN"}
+}`
+
+func TestUnwrapEnvelope(t *testing.T) {
+	body, metadata := unwrapEnvelope(testEventBridgeEvent)
+	if body != `{"command": "echo $SQSJKR_EVENT_RULE_NAME $SQSJKR_SNS_TOPIC_ARN"}` {
+		t.Errorf("unexpected body: %s", body)
+	}
+	if metadata[MetadataRuleName] != "nightly_batch" || metadata[MetadataEventSource] != "my.app" || metadata[MetadataDetailType] != "job" {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+
+	plain := `{"command": "echo hello", "event_id": "hello"}`
+	if body, metadata := unwrapEnvelope(plain); body != plain || len(metadata) != 0 {
+		t.Errorf("job body should not be unwrapped: %s %v", body, metadata)
+	}
+}
+
+func TestJobInSNSEnvelope(t *testing.T) {
+	// EventBridge -> SNS -> SQS
+	msgJSON, _ := json.Marshal(testEventBridgeEvent)
+	body := `{
+  "Type": "Notification",
+  "MessageId": "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+  "TopicArn": "arn:aws:sns:ap-northeast-1:123456789012:jobs",
+  "Message": ` + string(msgJSON) + `,
+  "Timestamp": "2021-02-15T00:00:00.000Z"
+}`
+	msg := &Message{
+		ID:         "msg-1",
+		Body:       body,
+		Attributes: map[string]string{"SentTimestamp": "1523261130000"},
+	}
+
+	job, err := (&JobParser{}).parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.EventID() != "nightly_batch" {
+		t.Errorf("event_id should be the rule name: %s", job.EventID())
+	}
+	out, err := job.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(out)); s != "nightly_batch arn:aws:sns:ap-northeast-1:123456789012:jobs" {
+		t.Errorf("metadata should be passed by env: %s", s)
+	}
+}
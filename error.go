@@ -6,4 +6,11 @@ import (
 
 var (
 	ErrOverLifeTime = errors.New("over life time")
+	ErrLocked       = errors.New("aborted because of locked")
+	ErrTimedOut     = errors.New("timed out")
+
+	ErrLimitExceeded = errors.New("resource limit exceeded")
+
+	ErrUnsigned         = errors.New("message is not signed")
+	ErrInvalidSignature = errors.New("invalid signature")
 )
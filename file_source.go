@@ -0,0 +1,162 @@
+package sqsjkr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// FileSource is the MessageSource which reads messages from the JSON lines
+// file. Each line of the file is a message body, and lines appended to the
+// file are received as new messages.
+type FileSource struct {
+	Path              string
+	VisibilityTimeout time.Duration
+	PollInterval      time.Duration
+
+	mu       sync.Mutex
+	offset   int64
+	lineNum  int
+	inflight map[string]*fileMessage
+}
+
+type fileMessage struct {
+	msg       *Message
+	visibleAt time.Time
+}
+
+// NewFileSource build FileSource
+func NewFileSource(path string, visibilityTimeout time.Duration) *FileSource {
+	return &FileSource{
+		Path:              path,
+		VisibilityTimeout: visibilityTimeout,
+		PollInterval:      time.Second,
+		inflight:          map[string]*fileMessage{},
+	}
+}
+
+// Receive receives messages which became visible again or are appended to
+// the file. Receive waits for PollInterval if there are no messages.
+func (s *FileSource) Receive(ctx context.Context, max int) ([]*Message, error) {
+	msgs, err := s.receive(max)
+	if err != nil || len(msgs) > 0 {
+		return msgs, err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(s.PollInterval):
+	}
+	return nil, nil
+}
+
+func (s *FileSource) receive(max int) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var msgs []*Message
+
+	// redelivers messages whose visibility timeout expired
+	for _, fm := range s.inflight {
+		if len(msgs) >= max {
+			return msgs, nil
+		}
+		if fm.visibleAt.After(now) {
+			continue
+		}
+		msgs = append(msgs, s.deliver(fm, now))
+	}
+
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return msgs, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(s.offset, io.SeekStart); err != nil {
+		return msgs, err
+	}
+
+	r := bufio.NewReader(f)
+	for len(msgs) < max {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// an incomplete line will be read at next time
+			break
+		} else if err != nil {
+			return msgs, err
+		}
+		s.offset += int64(len(line))
+		s.lineNum++
+
+		body := strings.TrimSpace(line)
+		if body == "" {
+			continue
+		}
+		id := fmt.Sprintf("%s:%d", filepath.Base(s.Path), s.lineNum)
+		fm := &fileMessage{
+			msg: &Message{
+				ID:            id,
+				Body:          body,
+				ReceiptHandle: id,
+				Attributes: map[string]string{
+					sqs.MessageSystemAttributeNameSentTimestamp: strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10),
+				},
+				MessageAttributes: map[string]string{},
+			},
+		}
+		s.inflight[id] = fm
+		msgs = append(msgs, s.deliver(fm, now))
+	}
+	return msgs, nil
+}
+
+// deliver counts up the receive count of the message and hides it for the
+// visibility timeout, and returns a copy of the message.
+func (s *FileSource) deliver(fm *fileMessage, now time.Time) *Message {
+	fm.visibleAt = now.Add(s.VisibilityTimeout)
+	fm.msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount] = strconv.FormatInt(fm.msg.ReceiveCount()+1, 10)
+
+	msg := *fm.msg
+	msg.Attributes = make(map[string]string, len(fm.msg.Attributes))
+	for k, v := range fm.msg.Attributes {
+		msg.Attributes[k] = v
+	}
+	return &msg
+}
+
+// Ack forgets the message
+func (s *FileSource) Ack(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inflight, msg.ReceiptHandle)
+	return nil
+}
+
+// Nack does nothing, the message is redelivered after the visibility timeout.
+func (s *FileSource) Nack(msg *Message) error {
+	return nil
+}
+
+// Extend changes the visibility timeout of the message
+func (s *FileSource) Extend(msg *Message, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fm, ok := s.inflight[msg.ReceiptHandle]
+	if !ok {
+		return fmt.Errorf("message %s is not in flight", msg.ID)
+	}
+	fm.visibleAt = time.Now().Add(timeout)
+	return nil
+}
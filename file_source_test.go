@@ -0,0 +1,64 @@
+package sqsjkr
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jobs.jsonl")
+	if err := ioutil.WriteFile(path, []byte("{\"command\":\"echo 1\"}\n\n{\"command\":\"echo 2\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	src := NewFileSource(path, time.Minute)
+	src.PollInterval = time.Millisecond
+
+	msgs, err := src.Receive(ctx, MaxRetrieveMessageNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Body != `{"command":"echo 1"}` || msgs[1].ReceiveCount() != 1 {
+		t.Fatalf("unexpected messages: %#v", msgs)
+	}
+	if _, err := msgs[0].SentTimestamp(); err != nil {
+		t.Error(err)
+	}
+
+	// the second message becomes visible again
+	src.Ack(msgs[0])
+	src.Extend(msgs[1], 0)
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("{\"command\":\"echo 3\"}\n")
+	f.Close()
+
+	msgs, err = src.Receive(ctx, MaxRetrieveMessageNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("unexpected messages: %#v", msgs)
+	}
+	if msgs[0].Body != `{"command":"echo 2"}` || msgs[0].ReceiveCount() != 2 {
+		t.Errorf("unexpected redelivered message: %#v", msgs[0])
+	}
+	if msgs[1].Body != `{"command":"echo 3"}` || msgs[1].ReceiveCount() != 1 {
+		t.Errorf("unexpected appended message: %#v", msgs[1])
+	}
+
+	// invisible messages
+	msgs, err = src.Receive(ctx, MaxRetrieveMessageNum)
+	if err != nil || len(msgs) != 0 {
+		t.Errorf("unexpected messages: %#v, err: %v", msgs, err)
+	}
+}
@@ -0,0 +1,78 @@
+package sqsjkr
+
+import (
+	"context"
+	"sync"
+)
+
+// groupQueue keeps jobs of each message group in order, and lets only one
+// job of a group run at once. Waiting jobs never start after ctx is done.
+type groupQueue struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	pending map[string][]Job // the key exists while a job of the group is running
+}
+
+func newGroupQueue(ctx context.Context) *groupQueue {
+	return &groupQueue{
+		ctx:     ctx,
+		pending: map[string][]Job{},
+	}
+}
+
+// push reports whether the job can run now. If a job of the group is
+// running, the job waits for the job in the group queue.
+func (g *groupQueue) push(group string, job Job) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	jobs, running := g.pending[group]
+	g.pending[group] = append(jobs, job)
+	if running {
+		return false
+	}
+	g.pending[group] = jobs
+	return true
+}
+
+// next returns the next job of the group after the running job has been
+// finished. next returns nil if no jobs of the group are waiting, or ctx
+// is done. The waiting jobs are left to be drained after ctx is done.
+func (g *groupQueue) next(group string) Job {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.ctx.Err() != nil {
+		return nil
+	}
+	jobs := g.pending[group]
+	if len(jobs) == 0 {
+		delete(g.pending, group)
+		return nil
+	}
+	g.pending[group] = jobs[1:]
+	return jobs[0]
+}
+
+// drain removes all waiting jobs, and returns them.
+func (g *groupQueue) drain() []Job {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var jobs []Job
+	for group, js := range g.pending {
+		jobs = append(jobs, js...)
+		g.pending[group] = nil
+	}
+	return jobs
+}
+
+// cancel removes the group and returns its waiting jobs.
+func (g *groupQueue) cancel(group string) []Job {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	jobs := g.pending[group]
+	delete(g.pending, group)
+	return jobs
+}
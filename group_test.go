@@ -0,0 +1,164 @@
+package sqsjkr
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGroupQueue(t *testing.T) {
+	g := newGroupQueue(context.Background())
+
+	if !g.push("group1", NewTestJob("job-1")) {
+		t.Error("the first job of the group should run")
+	}
+	if !g.push("group2", NewTestJob("job-a")) {
+		t.Error("the first job of the other group should run")
+	}
+	if g.push("group1", NewTestJob("job-2")) || g.push("group1", NewTestJob("job-3")) {
+		t.Error("jobs should wait for the running job of the group")
+	}
+
+	for _, expect := range []string{"job-2", "job-3"} {
+		job := g.next("group1")
+		if job == nil || job.JobID() != expect {
+			t.Errorf("unexpected next job: got=%v, expected=%s", job, expect)
+		}
+	}
+	if job := g.next("group1"); job != nil {
+		t.Errorf("no jobs should be waiting: got=%v", job)
+	}
+	if !g.push("group1", NewTestJob("job-4")) {
+		t.Error("the job of the idle group should run")
+	}
+}
+
+func TestGroupQueueAfterShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := newGroupQueue(ctx)
+	g.push("group1", NewTestJob("job-1"))
+	g.push("group1", NewTestJob("job-2"))
+
+	// the running job finished after shutdown began
+	cancel()
+	if job := g.next("group1"); job != nil {
+		t.Errorf("no jobs should start after shutdown: got=%v", job)
+	}
+	if jobs := g.drain(); len(jobs) != 1 || jobs[0].JobID() != "job-2" {
+		t.Errorf("waiting jobs should be drained: %v", jobs)
+	}
+}
+
+func TestJobMetadata(t *testing.T) {
+	msg := &Message{
+		ID:   "msg-1",
+		Body: `{"command":"echo hello"}`,
+		Attributes: map[string]string{
+			"SentTimestamp":          "1523261130000",
+			"MessageGroupId":         "group1",
+			"MessageDeduplicationId": "dedup1",
+			"SequenceNumber":         "18849496460467696128",
+		},
+	}
+	job, err := (&JobParser{}).parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.GroupID() != "group1" {
+		t.Errorf("unexpected group id: %s", job.GroupID())
+	}
+	if m := job.Metadata(); m[MessageDeduplicationID] != "dedup1" || m[SequenceNumber] != "18849496460467696128" {
+		t.Errorf("unexpected metadata: %v", m)
+	}
+	if s := formatMetadata(job.Metadata()); s != " MessageGroupId:group1 MessageDeduplicationId:dedup1 SequenceNumber:18849496460467696128" {
+		t.Errorf("unexpected formatted metadata: %s", s)
+	}
+}
+
+func TestRunJobsOfMessageGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	path := filepath.Join(dir, "jobs.jsonl")
+	var lines string
+	for i := 1; i <= 3; i++ {
+		lines += fmt.Sprintf(`{"command": "echo %d >> %s; sleep 0.6"}`+"\n", i, out)
+	}
+	if err := ioutil.WriteFile(path, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.SetConcurrentNum(2)
+	conf.SQS.VisibilityTimeout.Duration = time.Second
+	conf.SQS.HeartbeatInterval.Duration = 100 * time.Millisecond
+	src := NewFileSource(path, conf.SQS.visibilityTimeout())
+	sjkr := NewWithSource(conf, src)
+	sjkr.SetThrottler(&TestThrottle{table: map[string]bool{}})
+	sjkr.sched = newScheduler(2)
+	sjkr.groups = newGroupQueue(context.Background())
+	q := sjkr.queues[0]
+
+	stats := &Stats{busy: make(chan struct{}, 2)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		go spawnWorker(ctx, sjkr, i, sjkr.jobs, stats)
+	}
+
+	msgs, err := src.Receive(ctx, 3)
+	if err != nil || len(msgs) != 3 {
+		t.Fatalf("failed to receive messages: %v, %s", msgs, err)
+	}
+	for _, msg := range msgs {
+		msg.Attributes[MessageGroupID] = "group1"
+		if n := sjkr.reserve(ctx, q, 1); n != 1 {
+			t.Fatal("should reserve the idle worker")
+		}
+		sjkr.dispatch(ctx, q, msg)
+	}
+
+	// waiting jobs don't keep workers
+	sjkr.sched.mu.Lock()
+	idle := sjkr.sched.idle
+	sjkr.sched.mu.Unlock()
+	if idle != 1 {
+		t.Errorf("only the running job should keep a worker: idle=%d", idle)
+	}
+
+	// messages of the group are kept invisible over the visibility timeout
+	time.Sleep(1300 * time.Millisecond)
+	if msgs, err := src.Receive(ctx, 3); err != nil || len(msgs) != 0 {
+		t.Errorf("messages of the group should not be redelivered: %v, %s", msgs, err)
+	}
+
+	for start := time.Now(); ; time.Sleep(50 * time.Millisecond) {
+		src.mu.Lock()
+		n := len(src.inflight)
+		src.mu.Unlock()
+		sjkr.sched.mu.Lock()
+		idle = sjkr.sched.idle
+		sjkr.sched.mu.Unlock()
+		if n == 0 && idle == 2 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("messages should be deleted and workers should be released after jobs finished: messages=%d, idle=%d", n, idle)
+		}
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1\n2\n3\n" {
+		t.Errorf("jobs of the group should run one after another in order: %q", string(b))
+	}
+}
@@ -0,0 +1,342 @@
+package sqsjkr
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HistoryRecord is the record of a job run
+type HistoryRecord struct {
+	JobID      string    `json:"job_id"`
+	EventID    string    `json:"event_id,omitempty"`
+	Command    string    `json:"command"`
+	EnvKeys    []string  `json:"env_keys,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	Output     string    `json:"output,omitempty"` // tail of the output
+	Host       string    `json:"host"`
+}
+
+// newHistoryRecord build HistoryRecord of the job by its result
+func newHistoryRecord(job Job, jr *JobResult, output []byte) *HistoryRecord {
+	rec := &HistoryRecord{
+		JobID:      jr.JobID,
+		EventID:    jr.EventID,
+		Command:    job.Command(),
+		StartedAt:  jr.StartedAt,
+		FinishedAt: jr.FinishedAt,
+		Outcome:    jr.Outcome,
+		Reason:     jr.Reason,
+		ExitCode:   jr.ExitCode,
+		Host:       jr.Host,
+	}
+	if e, ok := job.(interface{ EnvKeys() []string }); ok {
+		rec.EnvKeys = e.EnvKeys()
+	}
+	if len(output) > HistoryOutputSize {
+		output = output[len(output)-HistoryOutputSize:]
+	}
+	rec.Output = string(output)
+	return rec
+}
+
+// HistoryQuery is the condition of records to find in History
+type HistoryQuery struct {
+	JobID   string
+	EventID string
+	Outcome string
+	Since   time.Time
+	Limit   int
+}
+
+func (q HistoryQuery) match(rec *HistoryRecord) bool {
+	return (q.JobID == "" || rec.JobID == q.JobID) &&
+		(q.EventID == "" || rec.EventID == q.EventID) &&
+		(q.Outcome == "" || rec.Outcome == q.Outcome) &&
+		!rec.StartedAt.Before(q.Since)
+}
+
+// History is the local store of job runs in the JSON lines file. Records
+// older than maxAge are expired, and old records are removed when the file
+// grows over maxSize. Queries read the file without blocking Add, and the
+// file is compacted in background.
+type History struct {
+	path    string
+	maxAge  time.Duration
+	maxSize int64
+
+	mu         sync.Mutex
+	size       int64
+	compacted  time.Time
+	compacting bool
+}
+
+// NewHistory build History which stores records in the file of path
+func NewHistory(path string, maxAge time.Duration, maxSize int64) (*History, error) {
+	if maxAge <= 0 {
+		maxAge = DefaultHistoryMaxAge
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultHistoryMaxSize
+	}
+	h := &History{path: path, maxAge: maxAge, maxSize: maxSize}
+	if err := h.compact(maxSize); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Add appends the record to the history
+func (h *History) Add(rec *HistoryRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	h.size += int64(len(b) + 1)
+
+	if h.compacting {
+		return nil
+	}
+	if h.size > h.maxSize {
+		// leaves room not to compact on every Add
+		h.compactInBackground(h.maxSize / 2)
+	} else if time.Since(h.compacted) > HistoryCompactInterval {
+		h.compactInBackground(h.maxSize)
+	}
+	return nil
+}
+
+// compactInBackground compacts the file in a new goroutine. h.mu must be
+// held.
+func (h *History) compactInBackground(size int64) {
+	h.compacting = true
+	go func() {
+		err := h.compact(size)
+		if err != nil {
+			logger.Errorf("failed to compact history %s: %s", h.path, err)
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.compacting = false
+		if err == nil && h.size > h.maxSize {
+			// records added while compacting are over size
+			h.compactInBackground(h.maxSize / 2)
+		}
+	}()
+}
+
+// Query returns the records which match q, newest first
+func (h *History) Query(q HistoryQuery) ([]*HistoryRecord, error) {
+	if since := time.Now().Add(-h.maxAge); q.Since.Before(since) {
+		q.Since = since
+	}
+	recs, _, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*HistoryRecord
+	for i := len(recs) - 1; i >= 0; i-- {
+		if !q.match(recs[i]) {
+			continue
+		}
+		found = append(found, recs[i])
+		if q.Limit > 0 && len(found) >= q.Limit {
+			break
+		}
+	}
+	return found, nil
+}
+
+// load reads the records in the file in the order they were added, and
+// returns the size of the read records. The records added while reading
+// are not read. The file is appended only, and replaced by rename on
+// compaction, so load holds h.mu only while opening the file.
+func (h *History) load() ([]*HistoryRecord, int64, error) {
+	h.mu.Lock()
+	f, err := os.Open(h.path)
+	size := h.size
+	h.mu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	if size == 0 {
+		// the size of the existing file is unknown before compaction
+		st, err := f.Stat()
+		if err != nil {
+			return nil, 0, err
+		}
+		size = st.Size()
+	}
+
+	var recs []*HistoryRecord
+	scanner := bufio.NewScanner(io.LimitReader(f, size))
+	scanner.Buffer(make([]byte, 64*1024), int(h.maxSize))
+	for scanner.Scan() {
+		var rec HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// skips the broken line, e.g. written partially on crash
+			continue
+		}
+		recs = append(recs, &rec)
+	}
+	return recs, size, scanner.Err()
+}
+
+// compact rewrites the file without expired records. When the file is
+// still over size, the oldest records are removed. Records are added while
+// compacting, and they are copied to the new file at last.
+func (h *History) compact(size int64) error {
+	recs, offset, err := h.load()
+	if err != nil {
+		return err
+	}
+
+	expire := time.Now().Add(-h.maxAge)
+	lines := make([][]byte, 0, len(recs))
+	var total int64
+	for _, rec := range recs {
+		if rec.StartedAt.Before(expire) {
+			continue
+		}
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, b)
+		total += int64(len(b) + 1)
+	}
+	for len(lines) > 0 && total > size {
+		total -= int64(len(lines[0]) + 1)
+		lines = lines[1:]
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(h.path), filepath.Base(h.path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, b := range lines {
+		w.Write(b)
+		w.WriteByte('\n')
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// copies records added after load
+	n, err := copyFrom(w, h.path, offset)
+	total += n
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	h.size = total
+	h.compacted = time.Now()
+	return nil
+}
+
+// copyFrom copies the file of path from offset to w
+func copyFrom(w io.Writer, path string, offset int64) (int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(w, f)
+}
+
+// historyHandler serves the records of History which match the query
+// parameters event_id, job_id, outcome, since (RFC3339 time or duration
+// before now) and limit.
+func historyHandler(h *History) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q := HistoryQuery{
+			JobID:   params.Get("job_id"),
+			EventID: params.Get("event_id"),
+			Outcome: params.Get("outcome"),
+			Limit:   DefaultHistoryLimit,
+		}
+		if s := params.Get("since"); s != "" {
+			if d, err := time.ParseDuration(s); err == nil {
+				q.Since = time.Now().Add(-d)
+			} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+				q.Since = t
+			} else {
+				http.Error(w, fmt.Sprintf("invalid since %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+		if s := params.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", s), http.StatusBadRequest)
+				return
+			}
+			q.Limit = n
+		}
+
+		recs, err := h.Query(q)
+		if err != nil {
+			logger.Errorf(err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if recs == nil {
+			recs = []*HistoryRecord{}
+		}
+		w.Header().Set("Content-type", ApplicationJSON)
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(map[string]interface{}{"jobs": recs}); err != nil {
+			logger.Errorf(err.Error())
+		}
+	})
+}
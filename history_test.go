@@ -0,0 +1,179 @@
+package sqsjkr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	h, err := NewHistory(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, rec := range []*HistoryRecord{
+		{JobID: "msg-0", EventID: "batch", StartedAt: now.Add(-2 * time.Hour)}, // expired
+		{JobID: "msg-1", EventID: "batch", Outcome: OutcomeErrored, StartedAt: now.Add(-30 * time.Minute)},
+		{JobID: "msg-2", EventID: "other", Outcome: OutcomeSucceeded, StartedAt: now.Add(-20 * time.Minute)},
+		{JobID: "msg-3", EventID: "batch", Outcome: OutcomeSucceeded, StartedAt: now.Add(-10 * time.Minute)},
+	} {
+		if err := h.Add(rec); err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+	}
+
+	recs, err := h.Query(HistoryQuery{EventID: "batch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].JobID != "msg-3" || recs[1].JobID != "msg-1" {
+		t.Errorf("unexpected records: %#v", recs)
+	}
+	recs, _ = h.Query(HistoryQuery{Outcome: OutcomeSucceeded, Limit: 1})
+	if len(recs) != 1 || recs[0].JobID != "msg-3" {
+		t.Errorf("unexpected records: %#v", recs)
+	}
+	recs, _ = h.Query(HistoryQuery{Since: now.Add(-25 * time.Minute)})
+	if len(recs) != 2 {
+		t.Errorf("unexpected records: %#v", recs)
+	}
+
+	// expired records are removed from the file on compaction
+	if _, err := NewHistory(path, time.Hour, 0); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(path)
+	var n int
+	for _, c := range b {
+		if c == '\n' {
+			n++
+		}
+	}
+	if n != 3 {
+		t.Errorf("expired record should be removed: %d records", n)
+	}
+}
+
+func TestHistoryMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	h, err := NewHistory(path, time.Hour, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := h.Add(&HistoryRecord{JobID: fmt.Sprintf("msg-%d", i), StartedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// compaction runs in background
+	for i := 0; ; i++ {
+		h.mu.Lock()
+		compacting := h.compacting
+		h.mu.Unlock()
+		st, _ := os.Stat(path)
+		if !compacting && st.Size() <= 4096 {
+			break
+		}
+		if i >= 100 {
+			t.Fatalf("history should be smaller than max size: %d", st.Size())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	recs, _ := h.Query(HistoryQuery{Limit: 1})
+	if len(recs) != 1 || recs[0].JobID != "msg-99" {
+		t.Errorf("the latest record should be kept: %#v", recs)
+	}
+}
+
+func TestCompactHistoryWhileAdding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	h, err := NewHistory(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 100; i++ {
+			if err := h.Add(&HistoryRecord{JobID: fmt.Sprintf("msg-%d", i), StartedAt: time.Now()}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for i := 0; i < 10; i++ {
+		if err := h.compact(h.maxSize); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.Query(HistoryQuery{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// records added while compacting are not lost
+	recs, _ := h.Query(HistoryQuery{})
+	if len(recs) != 100 {
+		t.Errorf("all records should be kept: %d records", len(recs))
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := NewHistory(filepath.Join(dir, "history.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Add(&HistoryRecord{JobID: "msg-1", EventID: "batch", StartedAt: time.Now()})
+	h.Add(&HistoryRecord{JobID: "msg-2", EventID: "other", StartedAt: time.Now()})
+
+	w := httptest.NewRecorder()
+	historyHandler(h).ServeHTTP(w, httptest.NewRequest("GET", "/jobs/history?event_id=batch&since=1h", nil))
+	var res struct {
+		Jobs []*HistoryRecord `json:"jobs"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Jobs) != 1 || res.Jobs[0].JobID != "msg-1" {
+		t.Errorf("unexpected response: %#v", res.Jobs)
+	}
+
+	w = httptest.NewRecorder()
+	historyHandler(h).ServeHTTP(w, httptest.NewRequest("GET", "/jobs/history?limit=-1", nil))
+	if w.Code != 400 {
+		t.Errorf("invalid limit should be bad request: %d", w.Code)
+	}
+}
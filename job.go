@@ -2,11 +2,13 @@ package sqsjkr
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -35,51 +37,140 @@ func (d *Duration) UnmarshalJSON(b []byte) (err error) {
 	return
 }
 
+// UnmarshalText Duration field to decode toml
+func (d *Duration) UnmarshalText(b []byte) (err error) {
+	if sec, perr := strconv.ParseInt(string(b), 10, 64); perr == nil {
+		d.Duration = time.Duration(sec) * time.Second
+		return nil
+	}
+	d.Duration, err = time.ParseDuration(string(b))
+	return
+}
+
 // DefaultJob is created by one SQS message's body
 type DefaultJob struct {
 	jobID         string // JobID is created by sqs messageID
 	environment   map[string]string
 	command       string
+	args          []string
+	shell         string
 	eventID       string
 	lifeTime      time.Duration
 	sentTimestamp time.Time
 	abortIfLocked bool
 	lockID        string
+	timeout       time.Duration
+	killTimeout   time.Duration
+	retry         RetryPolicy
+	attr          ProcessAttr
+	limits        ResourceLimits
+	cgroupRoot    string
+	stdin         []byte
+	params        map[string]json.RawMessage
+	replyTo       string
+	lockStarted   time.Time
+	lockWait      time.Duration
+	outputHead    int
+	outputTail    int
+	result        *Result
 	trigger       string
+	triggerShell  string
+	message       *Message
+	metadata      map[string]string
+	payload       *PayloadPointer // deleted after the job succeeded
+	store         ObjectStore
 }
 
 func (j *DefaultJob) String() string {
-	return fmt.Sprintf("%#v", j)
+	// stdin and params may be large or sensitive
+	c := *j
+	c.stdin = nil
+	if len(j.params) > 0 {
+		c.params = make(map[string]json.RawMessage, len(j.params))
+		c.environment = make(map[string]string, len(j.environment))
+		for key, val := range j.environment {
+			c.environment[key] = val
+		}
+		for key := range j.params {
+			c.params[key] = nil
+			if _, ok := c.environment[key]; ok {
+				// params of the named job are passed by env
+				c.environment[key] = "(redacted)"
+			}
+		}
+	}
+	return fmt.Sprintf("%#v stdin:(%d bytes)", &c, len(j.stdin))
 }
 
 // Job is sqsjkr job struct
 type Job interface {
-	Execute(lock.Locker) ([]byte, error)
+	Execute(context.Context, lock.Locker) ([]byte, error)
 	JobID() string
 	EventID() string
 	Command() string
 	String() string
 }
 
+// Acknowledger is implemented by the job which reports the result of
+// execution to the queue where the job came from.
+type Acknowledger interface {
+	// Ack completes the message of the job.
+	Ack() error
+	// Nack leaves the message of the job to be redelivered.
+	Nack() error
+	// Redeliverable reports whether the message is redelivered by Nack.
+	Redeliverable() bool
+}
+
+// Heartbeater is implemented by the job which keeps its message invisible
+// to other consumers while the job is running.
+type Heartbeater interface {
+	// Heartbeat extends visibility of the message until ctx is done.
+	Heartbeat(ctx context.Context)
+}
+
 // MessageBody for decoding json
 type MessageBody struct {
-	Command                string            `json:"command"`
-	Environments           map[string]string `json:"envs"`
-	EventID                string            `json:"event_id"`
-	LifeTime               Duration          `json:"life_time"`
-	LockID                 string            `json:"lock_id"`
-	AbortIfLocked          bool              `json:"abort_if_locked"`
-	DisableLifeTimeTrigger bool              `json:"disable_life_time_trigger"`
+	Command                string                     `json:"command"`
+	Environments           map[string]string          `json:"envs"`
+	Args                   []string                   `json:"args,omitempty"`
+	Shell                  string                     `json:"shell,omitempty"`
+	Job                    string                     `json:"job,omitempty"`
+	Params                 map[string]json.RawMessage `json:"params,omitempty"`
+	Stdin                  string                     `json:"stdin,omitempty"`
+	StdinEncoding          string                     `json:"stdin_encoding,omitempty"`
+	ReplyTo                string                     `json:"reply_to,omitempty"`
+	EventID                string                     `json:"event_id"`
+	LifeTime               Duration                   `json:"life_time"`
+	LockID                 string                     `json:"lock_id"`
+	AbortIfLocked          bool                       `json:"abort_if_locked"`
+	DisableLifeTimeTrigger bool                       `json:"disable_life_time_trigger"`
+	Timeout                Duration                   `json:"timeout,omitempty"`
+	RetryPolicy
+	ProcessAttr
+	ResourceLimits
 }
 
 func (m MessageBody) String() string {
+	// stdin and params may be large or sensitive
+	if m.Stdin != "" {
+		m.Stdin = fmt.Sprintf("(%d bytes)", len(m.Stdin))
+	}
+	if len(m.Params) > 0 {
+		params := make(map[string]json.RawMessage, len(m.Params))
+		for key := range m.Params {
+			params[key] = nil
+		}
+		m.Params = params
+	}
 	var b strings.Builder
 	json.NewEncoder(&b).Encode(m)
 	return strings.TrimSuffix(b.String(), "\n")
 }
 
-// Execute executes command
-func (j *DefaultJob) Execute(lkr lock.Locker) ([]byte, error) {
+// Execute executes command. When ctx is done or the job's timeout passed,
+// the command is terminated.
+func (j *DefaultJob) Execute(ctx context.Context, lkr lock.Locker) ([]byte, error) {
 	// 1. Checks job's lifetime.
 	if j.isOverLifeTime() {
 		if j.trigger == "" {
@@ -88,9 +179,9 @@ func (j *DefaultJob) Execute(lkr lock.Locker) ([]byte, error) {
 		}
 
 		msg := fmt.Sprintf("job_id:%s, event_id:%s, command:%s, life_time:%s, sent_timestamp:%s",
-			j.jobID, j.eventID, j.command, j.lifeTime.String(), j.sentTimestamp.String())
+			j.jobID, j.eventID, j.Command(), j.lifeTime.String(), j.sentTimestamp.String())
 
-		out, err := invokeTrigger(j.trigger, msg)
+		out, err := invokeTrigger(j.triggerShell, j.trigger, msg)
 		logger.Debugf("trigger output: %s", string(out))
 		if err != nil {
 			return nil, err
@@ -101,15 +192,31 @@ func (j *DefaultJob) Execute(lkr lock.Locker) ([]byte, error) {
 
 	// 2. Locks Job (if job's lockID have been locked already, retry to Execute() after 5sec).
 	if j.lockID != "" && j.eventID != "" && lkr != nil {
+		if j.lockStarted.IsZero() {
+			j.lockStarted = time.Now()
+		}
 		err := lkr.Lock(j.lockID, j.eventID)
 		if err != nil {
 			logger.Errorf(err.Error())
 			if j.abortIfLocked {
-				return nil, err
+				return nil, fmt.Errorf("%w: %s", ErrLocked, err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(JobRetryInterval):
 			}
-			time.Sleep(JobRetryInterval)
-			return j.Execute(lkr)
+			return j.Execute(ctx, lkr)
 		}
+		j.lockWait = time.Since(j.lockStarted)
+
+		// Unlocks job when Execute returns, even if the command never ran.
+		defer func() {
+			if derr := lkr.Unlock(j.lockID); derr != nil {
+				// TODO: should implement notification
+				logger.Errorf(derr.Error())
+			}
+		}()
 	}
 
 	// 3. Validation.
@@ -119,19 +226,71 @@ func (j *DefaultJob) Execute(lkr lock.Locker) ([]byte, error) {
 
 	// 4. Executes job.
 	env := os.Environ()
+	for _, m := range metadataEnvs {
+		if v, ok := j.metadata[m.name]; ok {
+			env = append(env, fmt.Sprintf("%s=%s", m.env, v))
+		}
+	}
+	if j.message != nil {
+		env = append(env, fmt.Sprintf("SQSJKR_ATTEMPT=%d", j.message.ReceiveCount()))
+	}
 	for key, val := range j.environment {
 		env = append(env, fmt.Sprintf("%s=%s", key, val))
 	}
-	cmd := exec.Command("sh", "-c", j.command)
+	argv := commandArgs(j.shell, j.command, j.args)
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("Job command undefined.")
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
 	cmd.Env = env
-	output, err := cmd.CombinedOutput()
-
-	// 5. Unlocks job.
-	if j.lockID != "" && lkr != nil {
-		if derr := lkr.Unlock(j.lockID); derr != nil {
-			// TODO: should implement notification
-			logger.Errorf(derr.Error())
+	umask, err := j.attr.umask()
+	if err != nil {
+		return nil, err
+	}
+	if err := j.attr.apply(cmd); err != nil {
+		return nil, err
+	}
+	if j.stdin != nil {
+		cmd.Stdin = bytes.NewReader(j.stdin)
+	}
+	if len(j.params) > 0 {
+		path, err := writeParams(j.params, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write params: %w", err)
 		}
+		defer os.Remove(path)
+		cmd.Env = append(cmd.Env, fmt.Sprintf("SQSJKR_PARAMS_FILE=%s", path))
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if j.timeout > 0 {
+		runCtx, cancel = context.WithTimeout(runCtx, j.timeout)
+		defer cancel()
+	}
+	rc := &resourceControl{limits: j.limits, cgroupRoot: j.cgroupRoot}
+	limit := &outputLimit{
+		max: int64(j.limits.MaxOutputSize),
+		exceeded: func() {
+			// stops the command which writes too large output
+			rc.setExceeded("max_output_size")
+			cancel()
+		},
+	}
+	j.result = newResult(j.outputHead, j.outputTail)
+	prefix := fmt.Sprintf("[event:%s][job:%s]", j.eventID, j.jobID)
+	var flush func()
+	cmd.Stdout, cmd.Stderr, flush = outputWriters(prefix, j.result, limit)
+	c := &command{Cmd: cmd, umask: umask, killTimeout: j.killTimeout}
+	if j.limits.enabled() {
+		c.resources = rc
+	}
+	err = c.run(runCtx)
+	flush()
+	output := j.result.Output.Bytes()
+	if limit := rc.exceededLimit(); limit != "" {
+		err = fmt.Errorf("%w: %s=%v: %v", ErrLimitExceeded, limit, j.limits.value(limit), err)
+	} else if err != nil && ctx.Err() == nil && runCtx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%w after %s: %s", ErrTimedOut, j.timeout, err)
 	}
 
 	return output, err
@@ -144,14 +303,113 @@ func (j DefaultJob) JobID() string {
 
 // Command return job's command
 func (j DefaultJob) Command() string {
+	if len(j.args) > 0 {
+		return strings.Join(j.args, " ")
+	}
 	return j.command
 }
 
+// Message return the message which the job is created by
+func (j DefaultJob) Message() *Message {
+	return j.message
+}
+
+// DeletePayload deletes the payload of the pointer message from the object
+// store.
+func (j DefaultJob) DeletePayload() error {
+	if j.payload == nil {
+		return nil
+	}
+	return j.store.Delete(j.payload.Bucket, j.payload.Key)
+}
+
+// Retryable reports whether the job failed by err should be retried by
+// its retry policy. The job without retry policy is always retryable.
+func (j DefaultJob) Retryable(err error) bool {
+	if !j.retry.enabled() {
+		return true
+	}
+	if !j.retry.retryable(err, j.attempt()) {
+		return false
+	}
+	if deadline, ok := j.Deadline(); ok && time.Now().Add(j.retryDelay()).After(deadline) {
+		logger.Warnf("[event:%s] could not retry the job over its life time", j.eventID)
+		return false
+	}
+	return true
+}
+
+// attempt returns the number of attempts of the job
+func (j DefaultJob) attempt() int64 {
+	if j.message == nil {
+		return 1
+	}
+	if n := j.message.ReceiveCount(); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// retryDelay returns the delay before retrying the job
+func (j DefaultJob) retryDelay() time.Duration {
+	return j.retry.delay(j.attempt())
+}
+
+// Metadata returns the attributes of the FIFO queue message (MessageGroupId,
+// MessageDeduplicationId and SequenceNumber) and the SNS or EventBridge
+// envelope (TopicArn, EventSource, DetailType and RuleName).
+func (j DefaultJob) Metadata() map[string]string {
+	return j.metadata
+}
+
+// Result returns the output of the executed command, or nil if the command
+// has not run.
+func (j *DefaultJob) Result() *Result {
+	return j.result
+}
+
+// LockWait returns the time which the job waited for its lock.
+func (j *DefaultJob) LockWait() time.Duration {
+	return j.lockWait
+}
+
+// EnvKeys returns the names of environment variables which the job sets.
+// The values are not exposed since they may be secrets.
+func (j DefaultJob) EnvKeys() []string {
+	keys := make([]string, 0, len(j.environment))
+	for key := range j.environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReplyTo returns the SQS queue url or the name of the sink which the
+// result of the job is sent to.
+func (j DefaultJob) ReplyTo() string {
+	return j.replyTo
+}
+
+// GroupID returns MessageGroupId of the message. GroupID is empty if the
+// message is not from a FIFO queue.
+func (j DefaultJob) GroupID() string {
+	return j.metadata[MessageGroupID]
+}
+
 // EventID return event_id
 func (j DefaultJob) EventID() string {
 	return j.eventID
 }
 
+// Deadline returns the time when job's life time runs out. ok is false if
+// the job has no life time.
+func (j *DefaultJob) Deadline() (deadline time.Time, ok bool) {
+	if j.lifeTime == 0 {
+		return time.Time{}, false
+	}
+	return j.sentTimestamp.Add(j.lifeTime), true
+}
+
 func (j DefaultJob) isOverLifeTime() bool {
 	diffTime := time.Now().Sub(j.sentTimestamp)
 
@@ -169,9 +427,12 @@ func (j DefaultJob) isOverLifeTime() bool {
 
 // Validates job can exec command
 func (j *DefaultJob) validate() error {
-	if j.command == "" {
+	if j.command == "" && len(j.args) == 0 {
 		return fmt.Errorf("Job command undefined.")
 	}
+	if j.command != "" && len(j.args) > 0 {
+		return fmt.Errorf("Job could not have both command and args.")
+	}
 	if j.jobID == "" {
 		return fmt.Errorf("JobID undefined.")
 	}
@@ -180,48 +441,277 @@ func (j *DefaultJob) validate() error {
 
 // NewJob create job
 func NewJob(msg *sqs.Message, trigger string) (Job, error) {
+	p := &JobParser{Trigger: trigger}
+	return p.NewJob(msg)
+}
+
+// JobParser creates jobs from messages
+type JobParser struct {
+	// Trigger is the command invoked when the life time of a job ran out.
+	Trigger string
+	// Store is the ObjectStore of payloads of pointer messages.
+	Store ObjectStore
+	// DeletePayload deletes the payload from Store after the job succeeded.
+	DeletePayload bool
+	// Jobs is the definitions of jobs which messages run by name.
+	Jobs map[string]JobSection
+	// Strict rejects messages which have free-form command instead of job.
+	Strict bool
+	// Retry is the default retry policy of jobs.
+	Retry RetryPolicy
+	// AllowedUsers, AllowedGroups and AllowedWorkdirs are the user, group
+	// and working directory (and its sub directories) which messages can
+	// run commands as.
+	AllowedUsers    []string
+	AllowedGroups   []string
+	AllowedWorkdirs []string
+	// Limits is the default resource limits of jobs. Messages can't loosen
+	// them.
+	Limits ResourceLimits
+	// CgroupRoot is the cgroup v2 directory where jobs' cgroups are created.
+	CgroupRoot string
+	// OutputHeadSize and OutputTailSize are the bytes of the head and the
+	// tail of the output kept for the result. The middle is dropped.
+	OutputHeadSize int
+	OutputTailSize int
+	// ReplyTo is the names of sinks and the urls of SQS queues which
+	// messages can reply to.
+	ReplyTo []string
+	// KeyRing verifies signatures of payloads in the object store. Unsigned
+	// payloads are allowed unless SignatureRequired is set.
+	KeyRing           KeyRing
+	SignatureRequired bool
+	// Shell is the default shell to run commands (default "sh -c").
+	Shell string
+	// Timeout is the default execution timeout of jobs.
+	Timeout time.Duration
+	// KillTimeout is the duration to wait for the command to exit after
+	// SIGTERM before sending SIGKILL.
+	KillTimeout time.Duration
+}
+
+// verifyPayload verifies the signature of the payload which the message
+// points to. The signature of the message body covers only the pointer.
+func (p *JobParser) verifyPayload(msg *Message, payload string) error {
+	if p.KeyRing == nil {
+		return nil
+	}
+	err := p.KeyRing.VerifyPayload(msg, payload)
+	if err == ErrUnsigned && !p.SignatureRequired {
+		return nil
+	}
+	return err
+}
+
+// NewJob create job
+func (p *JobParser) NewJob(msg *sqs.Message) (Job, error) {
+	return p.parse(newMessage(msg))
+}
+
+func (p *JobParser) parse(msg *Message) (*DefaultJob, error) {
+	payload := msg.Body
+	pointer, isPointer := parsePayloadPointer(payload)
+	if isPointer {
+		if p.Store == nil {
+			return nil, fmt.Errorf("message %s points to the payload %s, but object store is not configured", msg.ID, pointer)
+		}
+		b, err := p.Store.Get(pointer.Bucket, pointer.Key)
+		if err != nil {
+			logger.Errorf("Cannot get payload %s: %s", pointer, err.Error())
+			return nil, err
+		}
+		payload = string(b)
+		if err := p.verifyPayload(msg, payload); err != nil {
+			return nil, fmt.Errorf("payload %s of message %s is rejected: %w", pointer, msg.ID, err)
+		}
+	}
+	payload, metadata := unwrapEnvelope(payload)
+
 	var body MessageBody
-	if err := json.Unmarshal([]byte(*msg.Body), &body); err != nil {
+	if err := json.Unmarshal([]byte(payload), &body); err != nil {
 		logger.Errorf("Cannot parse message body: %s", err.Error())
 		return nil, err
 	}
+	stdin, err := decodeStdin(body.Stdin, body.StdinEncoding)
+	if err != nil {
+		logger.Errorf("Cannot decode stdin: %s", err.Error())
+		return nil, err
+	}
 
-	sentTimestamp, err := strconv.ParseInt(*msg.Attributes["SentTimestamp"], 10, 64)
+	sentTime, err := msg.SentTimestamp()
 	if err != nil {
 		logger.Errorf("Cannot parse attribute SentTimestamp: %s", err.Error())
 		return nil, err
 	}
-	sentTime := time.Unix(sentTimestamp/1000, sentTimestamp%1000*int64(time.Millisecond))
+
+	for _, name := range fifoAttributes {
+		if v, ok := msg.Attributes[name]; ok {
+			metadata[name] = v
+		}
+	}
 
 	logger.Infof(
-		"new job by message id:%s body:%s sentTimestamp:%s",
-		*msg.MessageId,
+		"new job by message id:%s body:%s sentTimestamp:%s%s",
+		msg.ID,
 		body.String(),
 		sentTime,
+		formatMetadata(metadata),
 	)
 
 	dj := &DefaultJob{
-		jobID:         *msg.MessageId,
+		jobID:         msg.ID,
 		command:       body.Command,
+		args:          body.Args,
+		shell:         body.Shell,
 		environment:   body.Environments,
 		eventID:       body.EventID,
 		lockID:        body.LockID,
 		abortIfLocked: body.AbortIfLocked,
 		lifeTime:      body.LifeTime.Duration,
+		timeout:       body.Timeout.Duration,
+		killTimeout:   p.KillTimeout,
+		retry:         body.RetryPolicy,
+		attr:          body.ProcessAttr,
+		limits:        body.ResourceLimits,
+		stdin:         stdin,
+		params:        body.Params,
+		replyTo:       body.ReplyTo,
 		sentTimestamp: sentTime,
+		message:       msg,
+		metadata:      metadata,
+	}
+	if err := body.ProcessAttr.permit(p.AllowedUsers, p.AllowedGroups, p.AllowedWorkdirs); err != nil {
+		logger.Errorf("Cannot run job: %s", err.Error())
+		return nil, err
+	}
+	if body.ReplyTo != "" && !contains(p.ReplyTo, body.ReplyTo) {
+		// the output of the job must not be sent to arbitrary queues
+		return nil, fmt.Errorf("reply_to %s is not allowed", body.ReplyTo)
+	}
+	if body.Job != "" {
+		if err := p.define(dj, body); err != nil {
+			logger.Errorf("Cannot define job: %s", err.Error())
+			return nil, err
+		}
+	} else if p.Strict {
+		return nil, fmt.Errorf("free-form command is not allowed in strict mode, message must have job")
+	}
+	dj.retry = dj.retry.merge(p.Retry)
+	dj.limits = dj.limits.merge(p.Limits)
+	dj.cgroupRoot = p.CgroupRoot
+	dj.outputHead, dj.outputTail = p.OutputHeadSize, p.OutputTailSize
+	if dj.outputHead <= 0 {
+		dj.outputHead = DefaultOutputHeadSize
+	}
+	if dj.outputTail <= 0 {
+		dj.outputTail = DefaultOutputTailSize
+	}
+	if dj.timeout == 0 {
+		dj.timeout = p.Timeout
+	}
+	if dj.killTimeout <= 0 {
+		dj.killTimeout = DefaultKillTimeout
+	}
+	if dj.shell == "" {
+		dj.shell = p.Shell
 	}
 	if !body.DisableLifeTimeTrigger {
-		dj.trigger = trigger
+		dj.trigger = p.Trigger
+		dj.triggerShell = p.Shell
+	}
+	if isPointer && p.DeletePayload {
+		dj.payload = pointer
+		dj.store = p.Store
+	}
+	if dj.eventID == "" {
+		dj.eventID = metadata[MetadataRuleName]
 	}
 	if dj.eventID == "" {
-		dj.eventID = *msg.MessageId
+		dj.eventID = body.Job
+	}
+	if dj.eventID == "" {
+		dj.eventID = msg.ID
 	}
 	return dj, nil
 }
 
+// define defines the job by the job definition which the message body
+// refers. The definition takes precedence over the message body, and the
+// message can set only allowed params as env.
+func (p *JobParser) define(dj *DefaultJob, body MessageBody) error {
+	def, ok := p.Jobs[body.Job]
+	if !ok {
+		return fmt.Errorf("job %s is not defined", body.Job)
+	}
+	if body.Command != "" || len(body.Args) > 0 || body.Shell != "" || len(body.Environments) > 0 {
+		return fmt.Errorf("message of job %s could not have command, args, shell or envs, use params", body.Job)
+	}
+
+	env := make(map[string]string, len(def.Envs)+len(body.Params))
+	for key, val := range def.Envs {
+		env[key] = val
+	}
+	for key, val := range body.Params {
+		if !def.allows(key) {
+			return fmt.Errorf("param %s is not allowed for job %s", key, body.Job)
+		}
+		env[key] = paramValue(val)
+	}
+
+	dj.command = def.Command
+	dj.args = def.Args
+	dj.shell = def.Shell
+	dj.environment = env
+	if def.Timeout.Duration > 0 {
+		dj.timeout = def.Timeout.Duration
+	}
+	dj.retry = def.RetryPolicy.merge(body.RetryPolicy)
+	dj.attr = def.ProcessAttr.merge(body.ProcessAttr)
+	dj.limits = def.ResourceLimits.merge(body.ResourceLimits)
+	if def.LifeTime.Duration > 0 {
+		dj.lifeTime = def.LifeTime.Duration
+	}
+	if def.LockID != "" {
+		dj.lockID = def.LockID
+		dj.abortIfLocked = def.AbortIfLocked
+	}
+	return nil
+}
+
+// formatMetadata formats metadata to append to log messages
+func formatMetadata(metadata map[string]string) string {
+	var b strings.Builder
+	for _, m := range metadataEnvs {
+		if v, ok := metadata[m.name]; ok {
+			fmt.Fprintf(&b, " %s:%s", m.name, v)
+		}
+	}
+	return b.String()
+}
+
+// commandArgs returns argv to execute. args are executed directly, and
+// command is executed by shell. When shell is "none", command is split by
+// white spaces and executed without shell.
+func commandArgs(shell, command string, args []string) []string {
+	if len(args) > 0 {
+		return args
+	}
+	switch shell {
+	case "":
+		shell = DefaultShell
+	case ShellNone:
+		return strings.Fields(command)
+	}
+	return append(strings.Fields(shell), command)
+}
+
 // invokeTrigger execute trigger command
-func invokeTrigger(command, msg string) ([]byte, error) {
-	cmd := exec.Command("sh", "-c", command)
+func invokeTrigger(shell, command, msg string) ([]byte, error) {
+	argv := commandArgs(shell, command, nil)
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("trigger command undefined")
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
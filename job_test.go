@@ -1,6 +1,8 @@
 package sqsjkr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -72,7 +74,7 @@ func TestExecute(t *testing.T) {
 		t.Errorf("wrong event_id: got=%s, expect='test_event'", job.EventID())
 	}
 
-	output, err := job.Execute(jobtestLocker)
+	output, err := job.Execute(context.Background(), jobtestLocker)
 	if err != nil {
 		t.Error(err)
 	}
@@ -90,7 +92,7 @@ func TestErrorExecuteWithWrongBody(t *testing.T) {
 		t.Errorf("%s", err)
 	}
 
-	output, err := job.Execute(jobtestLocker)
+	output, err := job.Execute(context.Background(), jobtestLocker)
 	if err == nil {
 		t.Errorf("Should returns error! err: %s, result: %s", err, string(output))
 	}
@@ -103,7 +105,7 @@ func TestTooLargeStdOut(t *testing.T) {
 		t.Errorf("%s", err)
 	}
 
-	output, err := job.Execute(jobtestLocker)
+	output, err := job.Execute(context.Background(), jobtestLocker)
 	if err != nil {
 		t.Errorf("%s, %s", err, string(output))
 	}
@@ -117,7 +119,7 @@ func TestOverLifeTime(t *testing.T) {
 	filename := "test/.triggered"
 	defer os.Remove(filename)
 	job, _ := NewJob(msg, "touch "+filename)
-	_, err := job.Execute(jobtestLocker)
+	_, err := job.Execute(context.Background(), jobtestLocker)
 
 	if err == nil {
 		t.Errorf("should not be error is nil")
@@ -131,7 +133,7 @@ func TestOverLifeTime(t *testing.T) {
 
 func TestInvokeTrigger(t *testing.T) {
 	msg := "job_id:1, event_id:test_event, command:'echo hoge', life_time:1, sent_timestamp:1"
-	out, err := invokeTrigger("./test/trigger_test.sh", msg)
+	out, err := invokeTrigger("", "./test/trigger_test.sh", msg)
 	if err != nil {
 		t.Error(err)
 	}
@@ -146,9 +148,9 @@ func TestLockUnlockJob(t *testing.T) {
 	job1, err := NewJob(wmsg, testTrigger)
 	job2, err := NewJob(wmsg, testTrigger)
 
-	go job1.Execute(jobtestLocker)
+	go job1.Execute(context.Background(), jobtestLocker)
 	time.Sleep(time.Second * 1)
-	output, err := job2.Execute(jobtestLocker)
+	output, err := job2.Execute(context.Background(), jobtestLocker)
 
 	if string(output) != "hello" {
 		t.Errorf("output is wrong: got=%s, expected=hello", string(output))
@@ -167,11 +169,11 @@ func TestAbortIfLockedJob(t *testing.T) {
 		t.Errorf("%s", err)
 	}
 
-	go job1.Execute(jobtestLocker)
+	go job1.Execute(context.Background(), jobtestLocker)
 	time.Sleep(time.Second * 1)
 
 	startTime := time.Now()
-	_, err = job2.Execute(jobtestLocker)
+	_, err = job2.Execute(context.Background(), jobtestLocker)
 	endTime := time.Now()
 
 	if err == nil {
@@ -193,7 +195,7 @@ func TestDisableLifeTimeTriggerJob(t *testing.T) {
 	}
 
 	time.Sleep(time.Second * 2)
-	b, err := job.Execute(jobtestLocker)
+	b, err := job.Execute(context.Background(), jobtestLocker)
 	if err != ErrOverLifeTime {
 		t.Errorf("unexpected err: %s expected:ErrOverLifeTime", err)
 	}
@@ -226,3 +228,96 @@ func buildMsg(body string) *sqs.Message {
 
 	return msg
 }
+
+func TestNamedJob(t *testing.T) {
+	conf, err := LoadConfig("./test/jobs.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &JobParser{Jobs: conf.Jobs, Strict: conf.Kicker.StrictJobs}
+
+	msg := &Message{
+		ID:         "msg-1",
+		Body:       `{"job": "nightly-report", "params": {"DATE": "2021-02-15"}}`,
+		Attributes: map[string]string{"SentTimestamp": strconv.FormatInt(time.Now().Unix()*1000, 10)},
+	}
+	job, err := p.parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.EventID() != "nightly-report" || job.lockID != "nightly-report" || job.lifeTime != time.Hour || job.timeout != 10*time.Minute {
+		t.Errorf("job should be defined by config: %s", job)
+	}
+	out, err := job.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "report 2021-02-15 csv\n" {
+		t.Errorf("unexpected output: %s", out)
+	}
+
+	for _, body := range []string{
+		`{"command": "echo hello"}`,
+		`{"job": "undefined"}`,
+		`{"job": "hello", "command": "rm -rf /"}`,
+		`{"job": "hello", "envs": {"LD_PRELOAD": "/tmp/evil.so"}}`,
+		`{"job": "nightly-report", "params": {"PATH": "/tmp"}}`,
+	} {
+		msg.Body = body
+		if job, err := p.parse(msg); err == nil {
+			t.Errorf("%s should be rejected: %s", body, job)
+		}
+	}
+}
+
+func TestTimeoutJob(t *testing.T) {
+	wmsg := buildMsg(`{
+    "command":   "sleep 30 & wait",
+    "event_id":  "test_event",
+    "lock_id":   "lock4",
+    "timeout":   "100ms"
+}`)
+	job, err := NewJob(wmsg, testTrigger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTime := time.Now()
+	_, err = job.Execute(context.Background(), jobtestLocker)
+	if !errors.Is(err, ErrTimedOut) {
+		t.Errorf("job should be timed out: %v", err)
+	}
+	if time.Since(startTime) > 5*time.Second {
+		t.Error("job was not terminated")
+	}
+	if err := jobtestLocker.Lock("lock4", "test_event"); err != nil {
+		t.Errorf("lock should be released: %s", err)
+	}
+	jobtestLocker.Unlock("lock4")
+}
+
+func TestArgsJob(t *testing.T) {
+	for body, expected := range map[string]string{
+		`{"args": ["echo", "$HOME; echo injected"]}`:              "$HOME; echo injected\n",
+		`{"command": "echo $0", "shell": "/bin/sh -c"}`:           "/bin/sh\n",
+		`{"command": "echo $HOME; echo ok", "shell": "none"}`:     "$HOME; echo ok\n",
+		`{"command": "echo hello; echo world", "shell": "sh -c"}`: "hello\nworld\n",
+	} {
+		job, err := NewJob(buildMsg(body), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := job.Execute(context.Background(), nil)
+		if err != nil {
+			t.Errorf("%s failed: %s", body, err)
+		}
+		if string(out) != expected {
+			t.Errorf("unexpected output of %s: got=%q, expected=%q", body, out, expected)
+		}
+	}
+
+	job, _ := NewJob(buildMsg(`{"command": "echo hello", "args": ["echo", "hello"]}`), "")
+	if _, err := job.Execute(context.Background(), nil); err == nil {
+		t.Error("job should not have both command and args")
+	}
+}
@@ -0,0 +1,125 @@
+package sqsjkr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ByteSize is the size in bytes, which is decoded from the number of bytes
+// or the string with the unit (e.g. "512K", "100M", "1G").
+type ByteSize int64
+
+// UnmarshalJSON ByteSize field to decode json
+func (s *ByteSize) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var str string
+		if err := json.Unmarshal(b, &str); err != nil {
+			return err
+		}
+		return s.UnmarshalText([]byte(str))
+	}
+	n, err := json.Number(string(b)).Int64()
+	*s = ByteSize(n)
+	return err
+}
+
+// UnmarshalText ByteSize field to decode toml
+func (s *ByteSize) UnmarshalText(b []byte) error {
+	str := strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(string(b)), "B"))
+	unit := int64(1)
+	for i, u := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(str, u) {
+			unit = 1 << (10 * uint(i+1))
+			str = strings.TrimSuffix(str, u)
+			break
+		}
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid byte size %q", string(b))
+	}
+	*s = ByteSize(n * unit)
+	return nil
+}
+
+// ResourceLimits is the limits of resources used by the command of the job
+type ResourceLimits struct {
+	MaxMemory     ByteSize `json:"max_memory,omitempty" toml:"max_memory"`
+	CPUQuota      float64  `json:"cpu_quota,omitempty" toml:"cpu_quota"`
+	MaxProcesses  int64    `json:"max_processes,omitempty" toml:"max_processes"`
+	MaxOpenFiles  int64    `json:"max_open_files,omitempty" toml:"max_open_files"`
+	MaxOutputSize ByteSize `json:"max_output_size,omitempty" toml:"max_output_size"`
+}
+
+// merge returns the limits which are the tighter of l and d
+func (l ResourceLimits) merge(d ResourceLimits) ResourceLimits {
+	tighter := func(a, b int64) int64 {
+		if a <= 0 || (b > 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	l.MaxMemory = ByteSize(tighter(int64(l.MaxMemory), int64(d.MaxMemory)))
+	l.MaxProcesses = tighter(l.MaxProcesses, d.MaxProcesses)
+	l.MaxOpenFiles = tighter(l.MaxOpenFiles, d.MaxOpenFiles)
+	l.MaxOutputSize = ByteSize(tighter(int64(l.MaxOutputSize), int64(d.MaxOutputSize)))
+	if l.CPUQuota <= 0 || (d.CPUQuota > 0 && d.CPUQuota < l.CPUQuota) {
+		l.CPUQuota = d.CPUQuota
+	}
+	return l
+}
+
+// value returns the value of the limit by name
+func (l ResourceLimits) value(name string) interface{} {
+	switch name {
+	case "max_memory":
+		return l.MaxMemory
+	case "cpu_quota":
+		return l.CPUQuota
+	case "max_processes":
+		return l.MaxProcesses
+	case "max_open_files":
+		return l.MaxOpenFiles
+	case "max_output_size":
+		return l.MaxOutputSize
+	}
+	return nil
+}
+
+// enabled reports whether any limits of the process are set
+func (l ResourceLimits) enabled() bool {
+	return l.MaxMemory > 0 || l.CPUQuota > 0 || l.MaxProcesses > 0 || l.MaxOpenFiles > 0
+}
+
+// resourceControl applies resource limits to the process of the command,
+// and reports which limit was exceeded.
+type resourceControl struct {
+	limits     ResourceLimits
+	cgroupRoot string
+	cgroup     string   // cgroup of the process, empty if cgroup is not used
+	ready      *os.File // the pipe to let the shim execute the command
+	readyR     *os.File // the other end of ready, which the shim inherits
+
+	mu       sync.Mutex
+	exceeded string
+}
+
+// setExceeded records the exceeded limit
+func (rc *resourceControl) setExceeded(limit string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.exceeded == "" {
+		rc.exceeded = limit
+	}
+}
+
+// exceededLimit returns the limit which the process exceeded, or empty.
+func (rc *resourceControl) exceededLimit() string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.exceeded
+}
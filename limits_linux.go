@@ -0,0 +1,191 @@
+package sqsjkr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// rlimitResources is the resources of rlimits applied by the shim
+var rlimitResources = map[string]int{
+	"nofile": syscall.RLIMIT_NOFILE,
+	"as":     syscall.RLIMIT_AS,
+}
+
+// prepare returns the settings of the shim which waits for sqsjkr to put
+// it into the cgroup of the job and applies rlimits, so the limits are
+// applied before the command runs. The cgroup is created under cgroupRoot
+// if cgroup v2 is available, otherwise the limits are applied by setrlimit.
+func (rc *resourceControl) prepare(cmd *exec.Cmd) ([]string, error) {
+	useCgroup := rc.cgroupRoot != "" && cgroupAvailable(rc.cgroupRoot)
+	var rlimits []string
+	if rc.limits.MaxOpenFiles > 0 {
+		rlimits = append(rlimits, fmt.Sprintf("nofile=%d", rc.limits.MaxOpenFiles))
+	}
+	if !useCgroup {
+		if rc.limits.MaxProcesses > 0 {
+			// RLIMIT_NPROC limits processes of the user, not of the job,
+			// and root ignores it
+			return nil, fmt.Errorf("max_processes requires cgroup v2, set cgroup_root")
+		}
+		if rc.limits.MaxMemory > 0 {
+			rlimits = append(rlimits, fmt.Sprintf("as=%d", rc.limits.MaxMemory))
+		}
+		if rc.limits.CPUQuota > 0 {
+			logger.Warnf("cpu_quota requires cgroup v2, ignored")
+		}
+	}
+	if !useCgroup {
+		return rlimits, nil
+	}
+
+	if err := rc.createCgroup(); err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	rc.ready, rc.readyR = w, r
+	cmd.ExtraFiles = []*os.File{r} // fd 3 of the shim
+	return append([]string{"wait"}, rlimits...), nil
+}
+
+// start puts the started shim into the cgroup, and lets it execute the
+// command.
+func (rc *resourceControl) start(pid int) error {
+	if rc.ready == nil {
+		return nil
+	}
+	rc.readyR.Close()
+	rc.readyR = nil
+	defer func() {
+		rc.ready.Close()
+		rc.ready = nil
+	}()
+
+	if rc.cgroup != "" {
+		if err := ioutil.WriteFile(filepath.Join(rc.cgroup, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("failed to put the process into cgroup: %s", err)
+		}
+	}
+	_, err := rc.ready.Write([]byte{1})
+	return err
+}
+
+func (rc *resourceControl) createCgroup() error {
+	dir, err := ioutil.TempDir(rc.cgroupRoot, "job-")
+	if err != nil {
+		return fmt.Errorf("failed to create cgroup: %s", err)
+	}
+	rc.cgroup = dir
+
+	files := map[string]string{}
+	if rc.limits.MaxMemory > 0 {
+		files["memory.max"] = strconv.FormatInt(int64(rc.limits.MaxMemory), 10)
+		files["memory.swap.max"] = "0"
+	}
+	if rc.limits.MaxProcesses > 0 {
+		files["pids.max"] = strconv.FormatInt(rc.limits.MaxProcesses, 10)
+	}
+	if rc.limits.CPUQuota > 0 {
+		const period = 100000
+		files["cpu.max"] = fmt.Sprintf("%d %d", int64(rc.limits.CPUQuota*period), period)
+	}
+	for name, val := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(val), 0644); err != nil && name != "memory.swap.max" {
+			return fmt.Errorf("failed to set %s of cgroup: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// check records the limit exceeded by the process in the cgroup
+func (rc *resourceControl) check() {
+	if rc.cgroup == "" {
+		return
+	}
+	if cgroupEvent(filepath.Join(rc.cgroup, "memory.events"), "oom_kill") > 0 {
+		rc.setExceeded("max_memory")
+	}
+	if cgroupEvent(filepath.Join(rc.cgroup, "pids.events"), "max") > 0 {
+		rc.setExceeded("max_processes")
+	}
+}
+
+// close closes the pipe to the shim, kills processes left in the cgroup,
+// and removes the cgroup
+func (rc *resourceControl) close() {
+	for _, f := range []*os.File{rc.ready, rc.readyR} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	rc.ready, rc.readyR = nil, nil
+	if rc.cgroup == "" {
+		return
+	}
+	ioutil.WriteFile(filepath.Join(rc.cgroup, "cgroup.kill"), []byte("1"), 0644)
+
+	// waits for killed processes to leave the cgroup
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = os.Remove(rc.cgroup); err == nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	logger.Errorf("failed to remove cgroup %s: %s", rc.cgroup, err)
+}
+
+// cgroupAvailable reports whether root is the cgroup v2 directory which
+// has memory, cpu and pids controllers for sub-trees.
+func cgroupAvailable(root string) bool {
+	b, err := ioutil.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+	if err != nil {
+		logger.Warnf("cgroup v2 is not available at %s: %s", root, err)
+		return false
+	}
+	enabled := strings.Fields(string(b))
+	for _, c := range []string{"memory", "cpu", "pids"} {
+		if contains(enabled, c) {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+"+c), 0644); err != nil {
+			logger.Warnf("failed to enable %s controller of cgroup %s: %s", c, root, err)
+			return false
+		}
+	}
+	return true
+}
+
+// cgroupEvent returns the count of the event in the events file of cgroup
+func cgroupEvent(path, event string) int64 {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 2 && f[0] == event {
+			n, _ := strconv.ParseInt(f[1], 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// setRlimit sets the rlimit of the resource by name
+func setRlimit(name string, v uint64) error {
+	res, ok := rlimitResources[name]
+	if !ok {
+		return fmt.Errorf("unknown rlimit %s", name)
+	}
+	return syscall.Setrlimit(res, &syscall.Rlimit{Cur: v, Max: v})
+}
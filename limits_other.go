@@ -0,0 +1,28 @@
+//go:build !linux
+// +build !linux
+
+package sqsjkr
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// prepare prepares cmd to apply the limits. Only linux supports resource
+// limits of the process.
+func (rc *resourceControl) prepare(cmd *exec.Cmd) ([]string, error) {
+	if rc.limits.enabled() {
+		logger.Warnf("resource limits of the process are not supported on this platform, ignored")
+	}
+	return nil, nil
+}
+
+func (rc *resourceControl) start(pid int) error { return nil }
+
+func (rc *resourceControl) check() {}
+
+func (rc *resourceControl) close() {}
+
+func setRlimit(name string, v uint64) error {
+	return fmt.Errorf("rlimit is not supported on this platform")
+}
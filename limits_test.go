@@ -0,0 +1,102 @@
+package sqsjkr
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestByteSize(t *testing.T) {
+	for str, expected := range map[string]ByteSize{
+		"1024":  1024,
+		"512K":  512 << 10,
+		"100MB": 100 << 20,
+		"1g":    1 << 30,
+	} {
+		var s ByteSize
+		if err := s.UnmarshalText([]byte(str)); err != nil {
+			t.Error(err)
+		}
+		if s != expected {
+			t.Errorf("unexpected size of %s: got=%d, expected=%d", str, s, expected)
+		}
+	}
+
+	var s ByteSize
+	if err := s.UnmarshalText([]byte("-1M")); err == nil {
+		t.Error("negative size should be invalid")
+	}
+}
+
+func TestMergeResourceLimits(t *testing.T) {
+	msg := ResourceLimits{MaxMemory: 2 << 30, MaxProcesses: 10}
+	conf := ResourceLimits{MaxMemory: 1 << 30, CPUQuota: 0.5}
+	l := msg.merge(conf)
+	if l.MaxMemory != 1<<30 || l.MaxProcesses != 10 || l.CPUQuota != 0.5 {
+		t.Errorf("messages should not loosen limits: %#v", l)
+	}
+}
+
+func TestMaxOutputSize(t *testing.T) {
+	job, err := NewJob(buildMsg(`{"command": "yes", "max_output_size": "1K"}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := job.Execute(context.Background(), nil)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("job should exceed max output size: %v", err)
+	}
+	if len(out) == 0 {
+		t.Error("output should be kept")
+	}
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are supported only on linux")
+	}
+	// the shim applies umask with rlimits
+	job, err := NewJob(buildMsg(`{"command": "ulimit -n; umask", "max_open_files": 64, "umask": "077"}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := job.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(out)); s != "64\n0077" {
+		t.Errorf("max open files and umask should be applied: %q", s)
+	}
+}
+
+func TestMaxMemoryByRlimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are supported only on linux")
+	}
+	job, err := NewJob(buildMsg(`{"args": ["sh", "-c", "ulimit -v"], "max_memory": "512M"}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := job.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(out)); s != "524288" {
+		t.Errorf("max memory should be limited by RLIMIT_AS without cgroup: %s", s)
+	}
+}
+
+func TestMaxProcessesRequiresCgroup(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are supported only on linux")
+	}
+	job, err := NewJob(buildMsg(`{"command": "true", "max_processes": 10}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := job.Execute(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "cgroup") {
+		t.Errorf("max_processes without cgroup should be refused: %v", err)
+	}
+}
@@ -99,6 +99,11 @@ func (dl DynamodbLock) Unlock(lockID string) error {
 
 // NewDynamodbLock build DynamodbLock
 func NewDynamodbLock(profile, region, table string) Locker {
+	return NewDynamodbLockWithEndpoint(profile, region, "", table)
+}
+
+// NewDynamodbLockWithEndpoint build DynamodbLock which uses the DynamoDB endpoint
+func NewDynamodbLockWithEndpoint(profile, region, endpoint, table string) Locker {
 	var conf *aws.Config
 	if profile != "" {
 		conf = &aws.Config{
@@ -110,6 +115,9 @@ func NewDynamodbLock(profile, region, table string) Locker {
 			Region: aws.String(region),
 		}
 	}
+	if endpoint != "" {
+		conf.Endpoint = aws.String(endpoint)
+	}
 	// configure Dynamodb
 	ddb := dynamodb.New(session.New(), conf)
 	return DynamodbLock{
@@ -0,0 +1,101 @@
+package sqsjkr
+
+import "time"
+
+// Operations of MessageSource notified to MetricsHook
+const (
+	OperationReceive          = "receive"
+	OperationDelete           = "delete"
+	OperationChangeVisibility = "change_visibility"
+)
+
+// JobEvent is the event of the job notified to MetricsHook
+type JobEvent struct {
+	Job   Job
+	Queue string // empty if the job is not from a queue
+	// Lag is the time from when the message was sent to when the job
+	// started, zero if unknown.
+	Lag time.Duration
+	// Outcome, Elapsed and LockWait are set when the job finished. LockWait
+	// is zero if the job has no lock.
+	Outcome  string
+	Elapsed  time.Duration
+	LockWait time.Duration
+}
+
+// UnknownEventID is the event_id of metrics for the job which has no
+// event_id, rule name nor job name.
+const UnknownEventID = "unknown"
+
+// metricEventID returns event_id of the job for labels of metrics. event_id
+// of the job falls back to its message ID, which must not be a label.
+func metricEventID(job Job) string {
+	if id := job.EventID(); id != "" && id != job.JobID() {
+		return id
+	}
+	return UnknownEventID
+}
+
+// newJobEvent build JobEvent of the job
+func newJobEvent(job Job) *JobEvent {
+	ev := &JobEvent{Job: job}
+	if q, ok := job.(interface{ QueueName() string }); ok {
+		ev.Queue = q.QueueName()
+	}
+	if m, ok := job.(interface{ Message() *Message }); ok && m.Message() != nil {
+		if sent, err := m.Message().SentTimestamp(); err == nil {
+			ev.Lag = time.Since(sent)
+		}
+	}
+	return ev
+}
+
+// MetricsHook is notified of events of jobs and queues to collect metrics
+type MetricsHook interface {
+	// JobStarted is called when the worker starts the job.
+	JobStarted(*JobEvent)
+	// JobFinished is called when the job finished with the outcome.
+	JobFinished(*JobEvent)
+	// JobDuplicated is called when the job is skipped by Throttler.
+	JobDuplicated(*JobEvent)
+	// MessagesReceived is called when n messages are received from the queue.
+	MessagesReceived(queue string, n int)
+	// SourceFailed is called when the operation of MessageSource failed.
+	SourceFailed(queue, operation string, err error)
+}
+
+// metricsHooks notifies events to all hooks
+type metricsHooks []MetricsHook
+
+func (hs metricsHooks) JobStarted(ev *JobEvent) {
+	for _, h := range hs {
+		h.JobStarted(ev)
+	}
+}
+
+func (hs metricsHooks) JobFinished(ev *JobEvent) {
+	for _, h := range hs {
+		h.JobFinished(ev)
+	}
+}
+
+func (hs metricsHooks) JobDuplicated(ev *JobEvent) {
+	for _, h := range hs {
+		h.JobDuplicated(ev)
+	}
+}
+
+func (hs metricsHooks) MessagesReceived(queue string, n int) {
+	for _, h := range hs {
+		h.MessagesReceived(queue, n)
+	}
+}
+
+func (hs metricsHooks) SourceFailed(queue, operation string, err error) {
+	if err == nil {
+		return
+	}
+	for _, h := range hs {
+		h.SourceFailed(queue, operation, err)
+	}
+}
@@ -0,0 +1,205 @@
+package sqsjkr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Output is the output stream of the command, which keeps the head and the
+// tail of the output and drops the middle of the large output.
+type Output struct {
+	mu   sync.Mutex
+	head []byte
+	tail []byte // ring buffer
+	pos  int    // next position to write in tail
+	size int64  // total bytes written
+
+	headSize int
+	tailSize int
+}
+
+func newOutput(headSize, tailSize int) *Output {
+	return &Output{
+		head:     make([]byte, 0, headSize),
+		tail:     make([]byte, 0, tailSize),
+		headSize: headSize,
+		tailSize: tailSize,
+	}
+}
+
+// Write keeps p in the head while the head is not full, and then in the tail.
+func (o *Output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := len(p)
+	o.size += int64(n)
+	if rest := o.headSize - len(o.head); rest > 0 {
+		if rest > len(p) {
+			rest = len(p)
+		}
+		o.head = append(o.head, p[:rest]...)
+		p = p[rest:]
+	}
+	if o.tailSize <= 0 {
+		return n, nil
+	}
+	if len(p) > o.tailSize {
+		p = p[len(p)-o.tailSize:]
+	}
+	for len(p) > 0 {
+		if len(o.tail) < o.tailSize {
+			c := o.tailSize - len(o.tail)
+			if c > len(p) {
+				c = len(p)
+			}
+			o.tail = append(o.tail, p[:c]...)
+			p = p[c:]
+			o.pos = len(o.tail) % o.tailSize
+			continue
+		}
+		c := copy(o.tail[o.pos:], p)
+		p = p[c:]
+		o.pos = (o.pos + c) % o.tailSize
+	}
+	return n, nil
+}
+
+// Bytes returns the kept output. The dropped middle of the output is noted
+// between the head and the tail.
+func (o *Output) Bytes() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var b bytes.Buffer
+	b.Write(o.head)
+	if dropped := o.truncated(); dropped > 0 {
+		fmt.Fprintf(&b, "\n... %d bytes truncated ...\n", dropped)
+	}
+	if len(o.tail) < o.tailSize {
+		b.Write(o.tail)
+	} else {
+		b.Write(o.tail[o.pos:])
+		b.Write(o.tail[:o.pos])
+	}
+	return b.Bytes()
+}
+
+// Size returns the total bytes of the output.
+func (o *Output) Size() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.size
+}
+
+// Truncated returns the bytes of the output which are dropped.
+func (o *Output) Truncated() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.truncated()
+}
+
+func (o *Output) truncated() int64 {
+	return o.size - int64(len(o.head)+len(o.tail))
+}
+
+// Result is the output of the executed command. Output keeps both of stdout
+// and stderr in the order they were written.
+type Result struct {
+	Stdout *Output
+	Stderr *Output
+	Output *Output
+}
+
+func newResult(headSize, tailSize int) *Result {
+	return &Result{
+		Stdout: newOutput(headSize, tailSize),
+		Stderr: newOutput(headSize, tailSize),
+		Output: newOutput(headSize, tailSize),
+	}
+}
+
+// Truncated reports whether any output of the command is dropped.
+func (r *Result) Truncated() bool {
+	return r.Output.Truncated() > 0
+}
+
+// lineLogger writes each line of the output to the logger with prefix.
+// The line longer than maxLogLineSize is cut off.
+type lineLogger struct {
+	prefix  string
+	logf    func(format string, args ...interface{})
+	line    []byte
+	dropped int
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		chunk := p
+		if i >= 0 {
+			chunk = p[:i]
+		}
+		if rest := maxLogLineSize - len(l.line); len(chunk) > rest {
+			l.line = append(l.line, chunk[:rest]...)
+			l.dropped += len(chunk) - rest
+		} else {
+			l.line = append(l.line, chunk...)
+		}
+		if i < 0 {
+			break
+		}
+		l.Flush()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Flush writes the rest of the output which does not end with newline.
+func (l *lineLogger) Flush() {
+	if len(l.line) == 0 && l.dropped == 0 {
+		return
+	}
+	if l.dropped > 0 {
+		l.logf("%s%s ... %d bytes truncated", l.prefix, l.line, l.dropped)
+	} else {
+		l.logf("%s%s", l.prefix, l.line)
+	}
+	l.line = l.line[:0]
+	l.dropped = 0
+}
+
+// outputLimit calls exceeded when the output exceeds max bytes.
+type outputLimit struct {
+	mu       sync.Mutex
+	size     int64
+	max      int64
+	exceeded func()
+}
+
+func (l *outputLimit) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.size += int64(len(p))
+	if l.max > 0 && l.size > l.max {
+		l.exceeded()
+	}
+	return len(p), nil
+}
+
+// outputWriters returns the writers of stdout and stderr of the command,
+// which stream the output to the logger and keep it in the result.
+func outputWriters(prefix string, result *Result, limit *outputLimit) (stdout, stderr io.Writer, flush func()) {
+	outLog := &lineLogger{prefix: prefix + "[stdout] ", logf: logger.Infof}
+	errLog := &lineLogger{prefix: prefix + "[stderr] ", logf: logger.Warnf}
+	stdout = io.MultiWriter(result.Stdout, result.Output, outLog, limit)
+	stderr = io.MultiWriter(result.Stderr, result.Output, errLog, limit)
+	flush = func() {
+		outLog.Flush()
+		errLog.Flush()
+	}
+	return stdout, stderr, flush
+}
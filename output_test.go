@@ -0,0 +1,69 @@
+package sqsjkr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOutput(t *testing.T) {
+	o := newOutput(4, 6)
+	for _, s := range []string{"he", "llo, ", "wor", "ld", "!!"} {
+		o.Write([]byte(s))
+	}
+	if s, expected := string(o.Bytes()), "hell\n... 4 bytes truncated ...\norld!!"; s != expected {
+		t.Errorf("unexpected output: got=%q, expected=%q", s, expected)
+	}
+	if o.Size() != 14 || o.Truncated() != 4 {
+		t.Errorf("unexpected size: %d, truncated: %d", o.Size(), o.Truncated())
+	}
+
+	o = newOutput(4, 6)
+	o.Write([]byte("short"))
+	if s := string(o.Bytes()); s != "short" {
+		t.Errorf("short output should not be truncated: %q", s)
+	}
+}
+
+func TestLineLogger(t *testing.T) {
+	var lines []string
+	l := &lineLogger{
+		prefix: "[test] ",
+		logf: func(format string, args ...interface{}) {
+			lines = append(lines, fmt.Sprintf(format, args...))
+		},
+	}
+	l.Write([]byte("foo\nba"))
+	l.Write([]byte("r\n"))
+	l.Write(bytes.Repeat([]byte("x"), maxLogLineSize+10))
+	l.Flush()
+
+	if len(lines) != 3 {
+		t.Fatalf("unexpected lines: %d", len(lines))
+	}
+	if lines[0] != "[test] foo" || lines[1] != "[test] bar" {
+		t.Errorf("unexpected lines: %q", lines[:2])
+	}
+	if !strings.HasSuffix(lines[2], "... 10 bytes truncated") {
+		t.Errorf("long line should be truncated: %q", lines[2][len(lines[2])-30:])
+	}
+}
+
+func TestStdoutAndStderr(t *testing.T) {
+	job, err := NewJob(buildMsg(`{"command": "echo out; echo err >&2"}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := job.Execute(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	r := job.(*DefaultJob).Result()
+	if s := string(r.Stdout.Bytes()); s != "out\n" {
+		t.Errorf("unexpected stdout: %q", s)
+	}
+	if s := string(r.Stderr.Bytes()); s != "err\n" {
+		t.Errorf("unexpected stderr: %q", s)
+	}
+}
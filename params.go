@@ -0,0 +1,75 @@
+package sqsjkr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// StdinEncodingBase64 is stdin_encoding of the message whose stdin is
+// encoded in base64.
+const StdinEncodingBase64 = "base64"
+
+// decodeStdin decodes stdin of the message by the encoding
+func decodeStdin(stdin, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		if stdin == "" {
+			return nil, nil
+		}
+		return []byte(stdin), nil
+	case StdinEncodingBase64:
+		b, err := base64.StdEncoding.DecodeString(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 stdin: %w", err)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown stdin_encoding %q", encoding)
+	}
+}
+
+// paramValue returns the value of the param as env. The string is set as
+// is, and other values are set in JSON.
+func paramValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	return string(v)
+}
+
+// writeParams writes params in JSON to the temporary file which the command
+// can read, and returns the path of the file.
+func writeParams(params map[string]json.RawMessage, cmd *exec.Cmd) (string, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile("", "sqsjkr-params-*.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	// the command may run as another user
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+		cred := cmd.SysProcAttr.Credential
+		if err := os.Chown(f.Name(), int(cred.Uid), int(cred.Gid)); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+	}
+	return f.Name(), nil
+}
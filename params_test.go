@@ -0,0 +1,87 @@
+package sqsjkr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStdin(t *testing.T) {
+	for _, body := range []string{
+		`{"command": "cat", "stdin": "{\"name\": \"sqsjkr\"}"}`,
+		`{"command": "cat", "stdin": "eyJuYW1lIjogInNxc2prciJ9", "stdin_encoding": "base64"}`,
+	} {
+		job, err := NewJob(buildMsg(body), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := job.Execute(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != `{"name": "sqsjkr"}` {
+			t.Errorf("unexpected output: %s", out)
+		}
+	}
+
+	for _, body := range []string{
+		`{"command": "cat", "stdin": "not base64!", "stdin_encoding": "base64"}`,
+		`{"command": "cat", "stdin": "foo", "stdin_encoding": "gzip"}`,
+	} {
+		if _, err := NewJob(buildMsg(body), ""); err == nil {
+			t.Errorf("%s should be invalid", body)
+		}
+	}
+}
+
+func TestParamsFile(t *testing.T) {
+	job, err := NewJob(buildMsg(`{"command": "cat $SQSJKR_PARAMS_FILE; echo; echo $SQSJKR_PARAMS_FILE", "params": {"date": "2021-02-15", "ids": [1, 2]}}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := job.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params, path string
+	if _, err := fmt.Sscan(string(out), &params, &path); err != nil {
+		t.Fatal(err)
+	}
+	if params != `{"date":"2021-02-15","ids":[1,2]}` {
+		t.Errorf("unexpected params: %s", params)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("params file should be removed: %s", path)
+	}
+}
+
+func TestRedactJobString(t *testing.T) {
+	p := &JobParser{Jobs: map[string]JobSection{
+		"report": {Command: "cat", Params: []string{"token"}},
+	}}
+	msg := &Message{
+		ID:         "msg-1",
+		Body:       `{"job": "report", "stdin": "secret-stdin", "params": {"token": "secret-param"}}`,
+		Attributes: map[string]string{"SentTimestamp": "1523261130000"},
+	}
+	var log bytes.Buffer
+	logger.Logger.SetOutput(&log)
+	job, err := p.parse(msg)
+	logger.Logger.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(log.String(), "secret") || !strings.Contains(log.String(), `"token":null`) {
+		t.Errorf("stdin and params should be redacted in log: %s", log.String())
+	}
+	s := job.String()
+	if strings.Contains(s, "secret") || strings.Contains(s, fmt.Sprintf("%#v", []byte("secret-stdin"))) {
+		t.Errorf("stdin and params should be redacted: %s", s)
+	}
+	if !strings.Contains(s, `"token"`) || !strings.Contains(s, "stdin:(12 bytes)") {
+		t.Errorf("names of params and size of stdin should be kept: %s", s)
+	}
+}
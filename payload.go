@@ -0,0 +1,127 @@
+package sqsjkr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// PayloadS3PointerClass is the class name of the pointer message of the SQS
+// Extended Client Library.
+const PayloadS3PointerClass = "software.amazon.payloadoffloading.PayloadS3Pointer"
+
+// ObjectStore is the storage of large message payloads
+type ObjectStore interface {
+	// Get returns the content of the object.
+	Get(bucket, key string) ([]byte, error)
+	// Delete deletes the object.
+	Delete(bucket, key string) error
+}
+
+// S3ObjectStore is the ObjectStore of AWS S3
+type S3ObjectStore struct {
+	S3 *s3.S3
+}
+
+// NewS3ObjectStore build S3ObjectStore
+func NewS3ObjectStore(s *s3.S3) *S3ObjectStore {
+	return &S3ObjectStore{S3: s}
+}
+
+// Get gets the object from S3
+func (s *S3ObjectStore) Get(bucket, key string) ([]byte, error) {
+	out, err := s.S3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// Delete deletes the object from S3
+func (s *S3ObjectStore) Delete(bucket, key string) error {
+	_, err := s.S3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// FileObjectStore is the ObjectStore on the local filesystem. The object is
+// stored in the file Dir/bucket/key.
+type FileObjectStore struct {
+	Dir string
+}
+
+// NewFileObjectStore build FileObjectStore
+func NewFileObjectStore(dir string) *FileObjectStore {
+	return &FileObjectStore{Dir: dir}
+}
+
+// Get reads the object file
+func (s *FileObjectStore) Get(bucket, key string) ([]byte, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+// Delete removes the object file
+func (s *FileObjectStore) Delete(bucket, key string) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (s *FileObjectStore) path(bucket, key string) (string, error) {
+	path := filepath.Join(s.Dir, bucket, key)
+	if !strings.HasPrefix(path, filepath.Clean(s.Dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object path: bucket:%s key:%s", bucket, key)
+	}
+	return path, nil
+}
+
+// PayloadPointer points to the object of the message payload
+type PayloadPointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+func (p PayloadPointer) String() string {
+	return fmt.Sprintf("s3://%s/%s", p.Bucket, p.Key)
+}
+
+// parsePayloadPointer parses the body of the pointer message, which is
+// `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"...","s3Key":"..."}]`.
+// ok is false if the body is not a pointer message.
+func parsePayloadPointer(body string) (p *PayloadPointer, ok bool) {
+	if !strings.HasPrefix(strings.TrimSpace(body), "[") {
+		return nil, false
+	}
+
+	var v []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &v); err != nil || len(v) != 2 {
+		return nil, false
+	}
+	var class string
+	if err := json.Unmarshal(v[0], &class); err != nil || class != PayloadS3PointerClass {
+		return nil, false
+	}
+	p = &PayloadPointer{}
+	if err := json.Unmarshal(v[1], p); err != nil || p.Bucket == "" || p.Key == "" {
+		return nil, false
+	}
+	return p, true
+}
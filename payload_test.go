@@ -0,0 +1,70 @@
+package sqsjkr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPayloadPointer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "bucket", "jobs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	object := filepath.Join(dir, "bucket", "jobs", "large.json")
+	if err := ioutil.WriteFile(object, []byte(`{"command":"echo large","event_id":"large_job"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{
+		ID:         "msg-1",
+		Body:       `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"jobs/large.json"}]`,
+		Attributes: map[string]string{"SentTimestamp": "1523261130000"},
+	}
+
+	if _, err := (&JobParser{}).parse(msg); err == nil {
+		t.Error("pointer message without object store should be an error")
+	}
+
+	p := &JobParser{Store: NewFileObjectStore(dir), DeletePayload: true}
+	job, err := p.parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Command() != "echo large" || job.EventID() != "large_job" {
+		t.Errorf("unexpected job: %s", job)
+	}
+	if job.Message().Body != msg.Body {
+		t.Errorf("the message of the job should be the pointer message: %s", job.Message().Body)
+	}
+
+	if err := job.DeletePayload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(object); !os.IsNotExist(err) {
+		t.Errorf("payload should be deleted: %v", err)
+	}
+}
+
+func TestParsePayloadPointer(t *testing.T) {
+	for _, body := range []string{
+		`{"command":"echo hello"}`,
+		`["other.Class",{"s3BucketName":"bucket","s3Key":"key"}]`,
+		`["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket"}]`,
+	} {
+		if p, ok := parsePayloadPointer(body); ok {
+			t.Errorf("%s should not be a pointer message: %s", body, p)
+		}
+	}
+
+	store := NewFileObjectStore("/tmp/sqsjkr")
+	if _, err := store.Get("bucket", "../../../etc/passwd"); err == nil {
+		t.Error("object path out of the directory should be an error")
+	}
+}
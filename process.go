@@ -0,0 +1,86 @@
+package sqsjkr
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// command is the command of the job which runs in its own process group
+type command struct {
+	*exec.Cmd
+	umask       int // inherits umask of sqsjkr if negative
+	killTimeout time.Duration
+	resources   *resourceControl // nil if no resource limits
+}
+
+// run runs the command until it exits. When ctx is done, run sends SIGTERM
+// to the process group, and sends SIGKILL after killTimeout passed.
+func (c *command) run(ctx context.Context) error {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Setpgid = true
+	// umask and resource limits are applied by the shim, which runs in
+	// the process of the command before exec
+	var shim []string
+	if c.resources != nil {
+		defer c.resources.close()
+		spec, err := c.resources.prepare(c.Cmd)
+		if err != nil {
+			return err
+		}
+		shim = append(shim, spec...)
+	}
+	if c.umask >= 0 {
+		shim = append(shim, fmt.Sprintf("umask=%o", c.umask))
+	}
+	if len(shim) > 0 {
+		if err := wrapShim(c.Cmd, shim); err != nil {
+			return err
+		}
+	}
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+
+	pgid := c.Process.Pid
+	if c.resources != nil {
+		// checks the cgroup before it is removed
+		defer c.resources.check()
+		if err := c.resources.start(pgid); err != nil {
+			syscall.Kill(-pgid, syscall.SIGKILL)
+			<-done
+			return err
+		}
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+		logger.Errorf("failed to send SIGTERM to process group %d: %s", pgid, err)
+	}
+
+	timer := time.NewTimer(c.killTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+	logger.Warnf("process group %d did not exit in %s after SIGTERM, send SIGKILL", pgid, c.killTimeout)
+	if err := syscall.Kill(-pgid, syscall.SIGKILL); err != nil {
+		logger.Errorf("failed to send SIGKILL to process group %d: %s", pgid, err)
+	}
+	return <-done
+}
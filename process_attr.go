@@ -0,0 +1,143 @@
+package sqsjkr
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ProcessAttr is the user, group, working directory and umask to run the
+// command of the job.
+type ProcessAttr struct {
+	User    string `json:"user,omitempty" toml:"user"`
+	Group   string `json:"group,omitempty" toml:"group"`
+	Workdir string `json:"workdir,omitempty" toml:"workdir"`
+	Umask   string `json:"umask,omitempty" toml:"umask"`
+}
+
+// merge returns the attributes whose unset fields are filled by d
+func (a ProcessAttr) merge(d ProcessAttr) ProcessAttr {
+	if a.User == "" {
+		a.User = d.User
+	}
+	if a.Group == "" {
+		a.Group = d.Group
+	}
+	if a.Workdir == "" {
+		a.Workdir = d.Workdir
+	}
+	if a.Umask == "" {
+		a.Umask = d.Umask
+	}
+	return a
+}
+
+// umask returns the umask, or -1 if umask is not specified.
+func (a ProcessAttr) umask() (int, error) {
+	if a.Umask == "" {
+		return -1, nil
+	}
+	m, err := strconv.ParseUint(a.Umask, 8, 32)
+	if err != nil || m > 0777 {
+		return -1, fmt.Errorf("invalid umask %q", a.Umask)
+	}
+	return int(m), nil
+}
+
+// permit checks the attributes requested by the message are allowed
+func (a ProcessAttr) permit(users, groups, workdirs []string) error {
+	if a.User != "" && !contains(users, a.User) {
+		return fmt.Errorf("user %s is not allowed", a.User)
+	}
+	if a.Group != "" && !contains(groups, a.Group) {
+		return fmt.Errorf("group %s is not allowed", a.Group)
+	}
+	if a.Workdir != "" {
+		allowed := false
+		dir := filepath.Clean(a.Workdir)
+		for _, d := range workdirs {
+			d = filepath.Clean(d)
+			if dir == d || strings.HasPrefix(dir, d+string(filepath.Separator)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("workdir %s is not allowed", a.Workdir)
+		}
+	}
+	_, err := a.umask()
+	return err
+}
+
+// apply sets the credential and the working directory to cmd
+func (a ProcessAttr) apply(cmd *exec.Cmd) error {
+	cmd.Dir = a.Workdir
+	if a.User == "" && a.Group == "" {
+		return nil
+	}
+
+	cred := &syscall.Credential{
+		Uid: uint32(syscall.Getuid()),
+		Gid: uint32(syscall.Getgid()),
+	}
+	if a.User != "" {
+		u, err := user.Lookup(a.User)
+		if err != nil {
+			return err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return err
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return err
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+
+		// supplementary groups of the user
+		gids, err := u.GroupIds()
+		if err != nil {
+			return err
+		}
+		for _, g := range gids {
+			if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+				cred.Groups = append(cred.Groups, uint32(id))
+			}
+		}
+	} else {
+		// keeps supplementary groups of sqsjkr
+		cred.NoSetGroups = true
+	}
+	if a.Group != "" {
+		g, err := user.LookupGroup(a.Group)
+		if err != nil {
+			return err
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return err
+		}
+		cred.Gid = uint32(gid)
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = cred
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package sqsjkr
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strings"
+	"testing"
+)
+
+func TestProcessAttr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := &JobParser{AllowedWorkdirs: []string{dir}}
+	msg := &Message{
+		ID:         "msg-1",
+		Body:       `{"command": "pwd; umask", "workdir": "` + dir + `", "umask": "027"}`,
+		Attributes: map[string]string{"SentTimestamp": "1523261130000"},
+	}
+	job, err := p.parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := job.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(out); s != dir+"\n0027\n" {
+		t.Errorf("unexpected output: %q", s)
+	}
+
+	for _, body := range []string{
+		`{"command": "id", "user": "root"}`,
+		`{"command": "id", "group": "root"}`,
+		`{"command": "pwd", "workdir": "/"}`,
+		`{"command": "pwd", "workdir": "` + dir + `/../"}`,
+		`{"command": "umask", "umask": "999"}`,
+	} {
+		msg.Body = body
+		if job, err := p.parse(msg); err == nil {
+			t.Errorf("%s should be rejected: %s", body, job)
+		}
+	}
+}
+
+func TestProcessAttrUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to run commands as other users")
+	}
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip(err)
+	}
+
+	p := &JobParser{AllowedUsers: []string{"nobody"}}
+	msg := &Message{
+		ID:         "msg-1",
+		Body:       `{"command": "id -un", "user": "nobody"}`,
+		Attributes: map[string]string{"SentTimestamp": "1523261130000"},
+	}
+	job, err := p.parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := job.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(out)); s != "nobody" {
+		t.Errorf("command should run as nobody: %s", s)
+	}
+}
+
+func TestUnlockFailedProcessAttr(t *testing.T) {
+	locker := &TestLocker{lockTable: map[string]bool{}}
+	p := &JobParser{AllowedUsers: []string{"sqsjkr-no-such-user"}}
+	msg := &Message{
+		ID:         "msg-1",
+		Body:       `{"command": "true", "user": "sqsjkr-no-such-user", "lock_id": "lock_attr", "event_id": "test_event"}`,
+		Attributes: map[string]string{"SentTimestamp": "1523261130000"},
+	}
+	job, err := p.parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := job.Execute(context.Background(), locker); err == nil {
+		t.Fatal("job should fail to look up the user")
+	}
+	if err := locker.Lock("lock_attr", "other_event"); err != nil {
+		t.Errorf("lock should be released after the job failed: %s", err)
+	}
+}
@@ -0,0 +1,29 @@
+package sqsjkr
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	cmd := &command{Cmd: exec.Command("sh", "-c", "sleep 30 & wait"), umask: -1, killTimeout: time.Second}
+	if err := cmd.run(ctx); err == nil || err.Error() != "signal: terminated" {
+		t.Errorf("process should be terminated: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("process group was not terminated")
+	}
+
+	// ignores SIGTERM, so it is stopped by SIGKILL
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	cmd = &command{Cmd: exec.Command("sh", "-c", "trap '' TERM; sleep 30 & wait"), umask: -1, killTimeout: 100 * time.Millisecond}
+	if err := cmd.run(ctx); err == nil || err.Error() != "signal: killed" {
+		t.Errorf("process should be killed: %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package sqsjkr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// content type of the Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	durationBuckets  = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+	lagBuckets       = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+	batchSizeBuckets = []float64{0, 1, 2, 5, 10}
+
+	// labelEscaper escapes label values as the exposition format requires
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// Prometheus collects metrics as MetricsHook, and serves them in the
+// Prometheus text exposition format.
+type Prometheus struct {
+	stats *Stats
+
+	mu           sync.Mutex
+	invocations  *metricVec
+	duplicates   *metricVec
+	sourceErrors *metricVec
+	jobDuration  *metricVec
+	queueLag     *metricVec
+	lockWait     *metricVec
+	batchSize    *metricVec
+}
+
+// NewPrometheus build Prometheus which also exports the workers of stats
+func NewPrometheus(stats *Stats) *Prometheus {
+	return &Prometheus{
+		stats: stats,
+		invocations: newCounterVec("sqsjkr_job_invocations_total",
+			"Number of finished jobs.", "event_id", "outcome"),
+		duplicates: newCounterVec("sqsjkr_throttle_duplicates_total",
+			"Number of jobs skipped as duplicated by throttler.", "queue"),
+		sourceErrors: newCounterVec("sqsjkr_sqs_errors_total",
+			"Number of failed API calls to the queue.", "queue", "operation"),
+		jobDuration: newHistogramVec("sqsjkr_job_duration_seconds",
+			"Execution time of jobs.", durationBuckets, "event_id"),
+		queueLag: newHistogramVec("sqsjkr_queue_lag_seconds",
+			"Time from when the message was sent to when the job started.", lagBuckets, "queue"),
+		lockWait: newHistogramVec("sqsjkr_lock_wait_seconds",
+			"Time to wait for the lock of jobs.", durationBuckets, "event_id"),
+		batchSize: newHistogramVec("sqsjkr_receive_batch_size",
+			"Number of messages received at once.", batchSizeBuckets, "queue"),
+	}
+}
+
+// JobStarted observes the queue lag of the job
+func (p *Prometheus) JobStarted(ev *JobEvent) {
+	if ev.Lag <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queueLag.observe(ev.Lag.Seconds(), ev.Queue)
+}
+
+// JobFinished counts the outcome of the job and observes its duration
+func (p *Prometheus) JobFinished(ev *JobEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	eventID := metricEventID(ev.Job)
+	p.invocations.add(1, eventID, ev.Outcome)
+	p.jobDuration.observe(ev.Elapsed.Seconds(), eventID)
+	if ev.LockWait > 0 {
+		p.lockWait.observe(ev.LockWait.Seconds(), eventID)
+	}
+}
+
+// JobDuplicated counts the duplicated job
+func (p *Prometheus) JobDuplicated(ev *JobEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.duplicates.add(1, ev.Queue)
+}
+
+// MessagesReceived observes the number of received messages
+func (p *Prometheus) MessagesReceived(queue string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batchSize.observe(float64(n), queue)
+}
+
+// SourceFailed counts the failed operation of the queue
+func (p *Prometheus) SourceFailed(queue, operation string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sourceErrors.add(1, queue, operation)
+}
+
+// ServeHTTP writes all metrics
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	bw := bufio.NewWriter(w)
+	if err := p.write(bw); err != nil {
+		logger.Errorf(err.Error())
+		return
+	}
+	if err := bw.Flush(); err != nil {
+		logger.Errorf(err.Error())
+	}
+}
+
+func (p *Prometheus) write(w io.Writer) error {
+	if p.stats != nil {
+		busy := len(p.stats.busy)
+		fmt.Fprintf(w, "# HELP sqsjkr_workers_busy Number of workers running jobs.\n# TYPE sqsjkr_workers_busy gauge\nsqsjkr_workers_busy %d\n", busy)
+		fmt.Fprintf(w, "# HELP sqsjkr_workers_idle Number of idle workers.\n# TYPE sqsjkr_workers_idle gauge\nsqsjkr_workers_idle %d\n", cap(p.stats.busy)-busy)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range []*metricVec{
+		p.invocations, p.duplicates, p.sourceErrors,
+		p.jobDuration, p.queueLag, p.lockWait, p.batchSize,
+	} {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricVec is the counter or the histogram partitioned by labels
+type metricVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64 // nil for the counter
+	series  map[string]*series
+}
+
+// series is the values of the metric with a set of label values
+type series struct {
+	values []string
+	sum    float64  // the value of the counter
+	counts []uint64 // cumulative counts of buckets
+	count  uint64
+}
+
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, labels: labels, series: map[string]*series{}}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*series{}}
+}
+
+func (m *metricVec) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: values, counts: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	return s
+}
+
+func (m *metricVec) add(v float64, values ...string) {
+	m.get(values).sum += v
+}
+
+func (m *metricVec) observe(v float64, values ...string) {
+	s := m.get(values)
+	for i, le := range m.buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (m *metricVec) write(w io.Writer) error {
+	typ := "counter"
+	if m.buckets != nil {
+		typ = "histogram"
+	}
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, typ); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := m.series[key]
+		labels := formatLabels(m.labels, s.values)
+		if m.buckets == nil {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, labels, formatFloat(s.sum))
+			continue
+		}
+		for i, le := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, withLabel(labels, "le", formatFloat(le)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, withLabel(labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, labels, formatFloat(s.sum))
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", m.name, labels, s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLabels formats labels as {name="value",...}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends the label to the formatted labels
+func withLabel(labels, name, value string) string {
+	pair := fmt.Sprintf(`%s="%s"`, name, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return strings.TrimSuffix(labels, "}") + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,99 @@
+package sqsjkr
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheus(t *testing.T) {
+	stats := &Stats{busy: make(chan struct{}, 3)}
+	stats.busy <- struct{}{}
+	p := NewPrometheus(stats)
+
+	job := &DefaultJob{jobID: "msg-1", eventID: `batch "daily"`}
+	p.JobStarted(&JobEvent{Job: job, Queue: "q1", Lag: 3 * time.Second})
+	p.JobFinished(&JobEvent{Job: job, Queue: "q1", Outcome: OutcomeSucceeded, Elapsed: 2 * time.Second, LockWait: time.Second})
+	p.JobFinished(&JobEvent{Job: job, Queue: "q1", Outcome: OutcomeErrored, Elapsed: 20 * time.Second})
+	p.JobDuplicated(&JobEvent{Job: job, Queue: "q1"})
+	p.MessagesReceived("q1", 10)
+	p.MessagesReceived("q1", 0)
+	p.SourceFailed("q1", OperationReceive, errors.New("throttled"))
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		"sqsjkr_workers_busy 1",
+		"sqsjkr_workers_idle 2",
+		"# TYPE sqsjkr_job_invocations_total counter",
+		`sqsjkr_job_invocations_total{event_id="batch \"daily\"",outcome="succeeded"} 1`,
+		`sqsjkr_job_invocations_total{event_id="batch \"daily\"",outcome="errored"} 1`,
+		"# TYPE sqsjkr_job_duration_seconds histogram",
+		`sqsjkr_job_duration_seconds_bucket{event_id="batch \"daily\"",le="5"} 1`,
+		`sqsjkr_job_duration_seconds_bucket{event_id="batch \"daily\"",le="+Inf"} 2`,
+		`sqsjkr_job_duration_seconds_sum{event_id="batch \"daily\""} 22`,
+		`sqsjkr_job_duration_seconds_count{event_id="batch \"daily\""} 2`,
+		`sqsjkr_queue_lag_seconds_bucket{queue="q1",le="1"} 0`,
+		`sqsjkr_queue_lag_seconds_bucket{queue="q1",le="5"} 1`,
+		`sqsjkr_lock_wait_seconds_count{event_id="batch \"daily\""} 1`,
+		`sqsjkr_throttle_duplicates_total{queue="q1"} 1`,
+		`sqsjkr_sqs_errors_total{queue="q1",operation="receive"} 1`,
+		`sqsjkr_receive_batch_size_bucket{queue="q1",le="0"} 1`,
+		`sqsjkr_receive_batch_size_sum{queue="q1"} 10`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics should have %s", line)
+		}
+	}
+	if t.Failed() {
+		t.Log(body)
+	}
+}
+
+func TestPrometheusUnknownEventID(t *testing.T) {
+	p := NewPrometheus(nil)
+	for _, body := range []string{`{"command": "true"}`, `{"command": "false"}`} {
+		job, err := NewJob(buildMsg(body), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.JobFinished(&JobEvent{Job: job, Outcome: OutcomeSucceeded})
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	// event_id of the message ID makes no series
+	if line := `sqsjkr_job_invocations_total{event_id="unknown",outcome="succeeded"} 2`; !strings.Contains(w.Body.String(), line) {
+		t.Errorf("metrics should have %s:\n%s", line, w.Body.String())
+	}
+}
+
+func TestWorkerMetricsHook(t *testing.T) {
+	p := NewPrometheus(nil)
+	sjkr := &DefaultSQSJkr{}
+	sjkr.AddMetricsHook(p)
+	w := Worker{
+		ctx:   context.Background(),
+		sjkr:  sjkr,
+		stats: &Stats{busy: make(chan struct{}, 1)},
+	}
+
+	job, err := NewJob(buildMsg(`{"command": "echo failed; exit 1", "event_id": "hook_event"}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.executeJob(job)
+
+	w2 := httptest.NewRecorder()
+	p.ServeHTTP(w2, httptest.NewRequest("GET", "/metrics", nil))
+	if line := `sqsjkr_job_invocations_total{event_id="hook_event",outcome="errored"} 1`; !strings.Contains(w2.Body.String(), line) {
+		t.Errorf("metrics should have %s:\n%s", line, w2.Body.String())
+	}
+}
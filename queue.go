@@ -0,0 +1,478 @@
+package sqsjkr
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queue is the message source polled by DefaultSQSJkr
+type queue struct {
+	name   string
+	source MessageSource
+	weight int
+	limit  int // 0 if the queue has no concurrency limit
+	stats  *QueueStats
+
+	// running and pass are guarded by the mutex of scheduler
+	running int
+	pass    float64
+}
+
+// QueueStats represents stats of a queue.
+type QueueStats struct {
+	Received            int64 `json:"received"`
+	InFlight            int64 `json:"in_flight"`
+	Succeeded           int64 `json:"succeeded"`
+	Failed              int64 `json:"failed"`
+	Errored             int64 `json:"errored"`
+	TimedOut            int64 `json:"timed_out"`
+	LimitExceeded       int64 `json:"limit_exceeded"`
+	ConsecutiveFailures int64 `json:"consecutive_failures"`
+}
+
+func newQueue(name string, src MessageSource, weight, maxConcurrentNum int) *queue {
+	q := &queue{
+		name:   name,
+		source: src,
+		weight: weight,
+		limit:  maxConcurrentNum,
+		stats:  &QueueStats{},
+	}
+	if q.weight <= 0 {
+		q.weight = 1
+	}
+	if q.limit < 0 {
+		q.limit = 0
+	}
+	return q
+}
+
+// snapshot returns a copy of the stats
+func (qs *QueueStats) snapshot() *QueueStats {
+	return &QueueStats{
+		Received:            atomic.LoadInt64(&qs.Received),
+		InFlight:            atomic.LoadInt64(&qs.InFlight),
+		Succeeded:           atomic.LoadInt64(&qs.Succeeded),
+		Failed:              atomic.LoadInt64(&qs.Failed),
+		Errored:             atomic.LoadInt64(&qs.Errored),
+		TimedOut:            atomic.LoadInt64(&qs.TimedOut),
+		LimitExceeded:       atomic.LoadInt64(&qs.LimitExceeded),
+		ConsecutiveFailures: atomic.LoadInt64(&qs.ConsecutiveFailures),
+	}
+}
+
+// QueuedJob is the job with the message received from MessageSource. When
+// the message is held, the message is acked after the job has been finished.
+type QueuedJob struct {
+	*DefaultJob
+	sjkr   *DefaultSQSJkr
+	queue  *queue
+	held   bool
+	nacked bool
+
+	mu       sync.Mutex
+	reserved bool   // the job keeps the worker reserved for it
+	started  bool   // the job started on a worker
+	waiting  func() // stops the heartbeat while waiting in the message group
+}
+
+// Ack deletes the message of the job from the source if the message is held.
+func (j *QueuedJob) Ack() error {
+	defer j.done()
+	if !j.held {
+		return nil
+	}
+	err := j.queue.source.Ack(j.message)
+	j.sjkr.metrics.SourceFailed(j.queue.name, OperationDelete, err)
+	return err
+}
+
+// Nack leaves the message of the job in the source, so the message will be
+// redelivered after the visibility timeout.
+func (j *QueuedJob) Nack() error {
+	defer j.done()
+	j.nacked = true
+	if j.retry.enabled() {
+		// retries the job after the backoff
+		delay := j.retryDelay()
+		logger.Infof("[event:%s] retry job after %s (attempt %d/%d)", j.eventID, delay, j.attempt()+1, j.retry.MaxRetries+1)
+		err := j.queue.source.Extend(j.message, delay)
+		j.sjkr.metrics.SourceFailed(j.queue.name, OperationChangeVisibility, err)
+		return err
+	}
+	err := j.queue.source.Nack(j.message)
+	j.sjkr.metrics.SourceFailed(j.queue.name, OperationChangeVisibility, err)
+	return err
+}
+
+// Redeliverable reports whether the message of the job is held.
+func (j *QueuedJob) Redeliverable() bool {
+	return j.held
+}
+
+// QueueName returns the name of the queue which the job came from.
+func (j *QueuedJob) QueueName() string {
+	return j.queue.name
+}
+
+// QueueStats returns the stats of the queue which the job came from.
+func (j *QueuedJob) QueueStats() *QueueStats {
+	return j.queue.stats
+}
+
+// Next returns the job which waits for the job in the same message group.
+// Next returns nil if the job is not in a message group, no jobs wait or
+// shutdown has begun.
+// When the job is left to be redelivered, the waiting jobs are released to
+// keep the order of the group.
+func (j *QueuedJob) Next() Job {
+	if j.GroupID() == "" {
+		return nil
+	}
+	if j.nacked {
+		for _, job := range j.sjkr.groups.cancel(j.GroupID()) {
+			job.(*QueuedJob).release()
+		}
+		return nil
+	}
+	next := j.sjkr.groups.next(j.GroupID())
+	if next == nil {
+		return nil
+	}
+	next.(*QueuedJob).start()
+	next.(*QueuedJob).begin()
+	return next
+}
+
+// wait lets the job wait for the running job of its message group. The
+// waiting job doesn't keep the worker reserved for it, and keeps its
+// message invisible until the job starts.
+func (j *QueuedJob) wait() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.started {
+		return
+	}
+	j.sjkr.sched.cancel(j.queue, 1)
+	j.reserved = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		j.Heartbeat(ctx)
+		close(stopped)
+	}()
+	j.waiting = func() {
+		cancel()
+		<-stopped
+	}
+}
+
+// start takes the worker which finished the previous job of the message
+// group for the waiting job.
+func (j *QueuedJob) start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.started = true
+	j.stopWaiting()
+	if !j.reserved {
+		j.sjkr.sched.take(j.queue)
+		j.reserved = true
+	}
+}
+
+// stopWaiting stops the heartbeat of the waiting job. j.mu must be held.
+func (j *QueuedJob) stopWaiting() {
+	if j.waiting != nil {
+		j.waiting()
+		j.waiting = nil
+	}
+}
+
+// begin deletes the message of the job which starts running if the message
+// is not held.
+func (j *QueuedJob) begin() {
+	if j.held {
+		return
+	}
+	if err := j.queue.source.Ack(j.message); err != nil {
+		j.sjkr.metrics.SourceFailed(j.queue.name, OperationDelete, err)
+		logger.Errorf("[msg_id:%s] failed to delete message: %s", j.message.ID, err)
+	}
+}
+
+// Release returns the message of the job to the source by resetting its
+// visibility timeout, so the message is redelivered immediately. The jobs
+// waiting in the same message group are also released to keep the order.
+func (j *QueuedJob) Release() error {
+	defer j.done()
+	j.nacked = true
+	err := j.queue.source.Extend(j.message, 0)
+	j.sjkr.metrics.SourceFailed(j.queue.name, OperationChangeVisibility, err)
+	return err
+}
+
+// release returns the message of the job which never started to the source.
+func (j *QueuedJob) release() {
+	j.mu.Lock()
+	j.stopWaiting()
+	j.mu.Unlock()
+	if err := j.Release(); err != nil {
+		logger.Errorf("[msg_id:%s] failed to release message: %s", j.message.ID, err)
+		return
+	}
+	logger.Infof("[msg_id:%s] released message which was not started", j.message.ID)
+}
+
+// done releases the worker reserved for the job
+func (j *QueuedJob) done() {
+	atomic.AddInt64(&j.queue.stats.InFlight, -1)
+	j.mu.Lock()
+	reserved := j.reserved
+	j.reserved = false
+	j.mu.Unlock()
+	if reserved {
+		j.sjkr.unreserve(j.queue, 1)
+	}
+}
+
+// Heartbeat extends the visibility timeout of the job's message periodically
+// until ctx is done or the job's life time runs out.
+func (j *QueuedJob) Heartbeat(ctx context.Context) {
+	if !j.held {
+		return
+	}
+
+	var expired <-chan time.Time
+	if deadline, ok := j.Deadline(); ok {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	timeout := j.sjkr.conf.SQS.visibilityTimeout()
+	ticker := time.NewTicker(j.sjkr.conf.SQS.heartbeatInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired:
+			logger.Warnf("[msg_id:%s] stop heartbeat, life time of the job ran out", j.message.ID)
+			return
+		case <-ticker.C:
+			if err := j.queue.source.Extend(j.message, timeout); err != nil {
+				j.sjkr.metrics.SourceFailed(j.queue.name, OperationChangeVisibility, err)
+				logger.Errorf("[msg_id:%s] failed to extend visibility timeout: %s", j.message.ID, err)
+			}
+		}
+	}
+}
+
+// poll receives messages from the queue and sends jobs to workers until
+// ctx is done.
+func (sjkr *DefaultSQSJkr) poll(ctx context.Context, q *queue) {
+	share := sjkr.share(q)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			// receives messages only as many as idle workers
+			n := sjkr.reserve(ctx, q, share)
+			if n == 0 {
+				continue
+			}
+
+			msgs, err := q.source.Receive(ctx, n)
+			if err != nil {
+				sjkr.metrics.SourceFailed(q.name, OperationReceive, err)
+				sjkr.sched.cancel(q, n)
+				failures := atomic.AddInt64(&q.stats.ConsecutiveFailures, 1)
+				wait := backoff(failures)
+				logger.Errorf("[queue:%s] failed to receive messages %d times in a row, retry after %s: %s", q.name, failures, wait, err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(wait):
+				}
+				continue
+			}
+			if n := atomic.SwapInt64(&q.stats.ConsecutiveFailures, 0); n >= DegradedFailureNum {
+				logger.Infof("[queue:%s] recovered from %d consecutive failures to receive messages", q.name, n)
+			}
+			sjkr.sched.cancel(q, n-len(msgs))
+			atomic.AddInt64(&q.stats.Received, int64(len(msgs)))
+			sjkr.metrics.MessagesReceived(q.name, len(msgs))
+
+			for _, msg := range msgs {
+				sjkr.dispatch(ctx, q, msg)
+			}
+
+			if len(msgs) == 0 && len(sjkr.queues) > 1 {
+				// the queues sharing workers are polled without waiting
+				// for messages, so waits before polling the empty queue
+				// again without reserving workers.
+				select {
+				case <-ctx.Done():
+				case <-time.After(SharedPollInterval):
+				}
+			}
+		}
+	}
+}
+
+// dispatch sends the job of the message to workers. If ctx is done before
+// a worker receives the job, the message is released.
+func (sjkr *DefaultSQSJkr) dispatch(ctx context.Context, q *queue, msg *Message) {
+	logger.Debugf("[queue:%s][msg_id:%s] body:%#v", q.name, msg.ID, msg.Body)
+	logger.Debugf("[attributes] sender_id:%s, sent_time_stamp:%s, appx_1st_recv_time:%s, appx_recv_cnt:%s",
+		msg.Attributes["SenderId"],
+		msg.Attributes["SentTimestamp"],
+		msg.Attributes["ApproximateFirstReceiveTimestamp"],
+		msg.Attributes["ApproximateReceiveCount"],
+	)
+
+	if err := sjkr.verify(msg); err != nil {
+		logger.Errorf("[queue:%s][msg_id:%s] rejected message: %s", q.name, msg.ID, err)
+		sjkr.discard(q, msg, OutcomeRejected, err)
+		return
+	}
+
+	job, err := sjkr.jobParser().parse(msg)
+	if errors.Is(err, ErrUnsigned) || errors.Is(err, ErrInvalidSignature) {
+		logger.Errorf("[queue:%s][msg_id:%s] rejected message: %s", q.name, msg.ID, err)
+		sjkr.discard(q, msg, OutcomeRejected, err)
+		return
+	} else if err != nil {
+		logger.Errorf(err.Error())
+		sjkr.discard(q, msg, OutcomeInvalidMessage, err)
+		return
+	}
+
+	// at-least-once mode, the job with retry policy or the message of a
+	// FIFO queue: the message is deleted by the worker after the job has
+	// been finished. The message group of the FIFO queue is blocked until
+	// the message is deleted, so jobs of the group never run out of order
+	// on other hosts.
+	held := sjkr.conf.SQS.AtLeastOnce || job.retry.enabled() || job.GroupID() != ""
+	atomic.AddInt64(&q.stats.InFlight, 1)
+	qj := &QueuedJob{DefaultJob: job, sjkr: sjkr, queue: q, held: held, reserved: true}
+	if group := job.GroupID(); group != "" && !sjkr.groups.push(group, qj) {
+		// the worker running the job of the same group runs it later
+		logger.Debugf("[queue:%s][msg_id:%s] waiting for the running job of group %s", q.name, msg.ID, group)
+		qj.wait()
+		return
+	}
+
+	// select picks one of ready cases randomly, so the job never starts
+	// after shutdown began
+	if ctx.Err() != nil {
+		qj.release()
+		return
+	}
+	select {
+	case sjkr.jobs <- qj:
+		qj.begin()
+	case <-ctx.Done():
+		qj.release()
+	}
+}
+
+// verify verifies the signature of the message if signature keys are
+// configured. Unsigned messages are allowed unless signatures are required.
+func (sjkr *DefaultSQSJkr) verify(msg *Message) error {
+	kr := sjkr.conf.Signature.keyRing()
+	if kr == nil {
+		return nil
+	}
+	err := kr.Verify(msg)
+	if err == ErrUnsigned && !sjkr.conf.Signature.Required {
+		return nil
+	}
+	return err
+}
+
+// discard sends the message which never runs to the dead letter
+// destination, and deletes it. The message is left to be redelivered if
+// the dead letter could not be sent.
+func (sjkr *DefaultSQSJkr) discard(q *queue, msg *Message, outcome string, reason error) {
+	defer sjkr.unreserve(q, 1)
+	if sjkr.deadLetter != nil {
+		if err := sjkr.deadLetter.Send(newDeadLetter(msg, outcome, reason)); err != nil {
+			logger.Errorf("[msg_id:%s] failed to send dead letter: %s", msg.ID, err)
+			sjkr.metrics.SourceFailed(q.name, OperationChangeVisibility, q.source.Nack(msg))
+			return
+		}
+	}
+	sjkr.metrics.SourceFailed(q.name, OperationDelete, q.source.Ack(msg))
+}
+
+// share returns the max number of messages received from the queue at once,
+// which is the weighted share of workers. Shares of all queues add up to
+// MaxConcurrentNum.
+func (sjkr *DefaultSQSJkr) share(q *queue) int {
+	max := sjkr.conf.Kicker.MaxConcurrentNum
+	var total int
+	for _, sq := range sjkr.queues {
+		total += sq.weight
+	}
+
+	// largest remainder method
+	shares := make([]int, len(sjkr.queues))
+	order := make([]int, len(sjkr.queues))
+	rest := max
+	for i, sq := range sjkr.queues {
+		shares[i] = max * sq.weight / total
+		rest -= shares[i]
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return max*sjkr.queues[order[a]].weight%total > max*sjkr.queues[order[b]].weight%total
+	})
+	for i := 0; i < rest; i++ {
+		shares[order[i]]++
+	}
+
+	var n int
+	for i, sq := range sjkr.queues {
+		if sq == q {
+			n = shares[i]
+		}
+	}
+	if n < 1 {
+		n = 1
+	} else if n > MaxRetrieveMessageNum {
+		n = MaxRetrieveMessageNum
+	}
+	return n
+}
+
+// reserve reserves workers for the queue up to max, and returns the number
+// of reserved workers. reserve blocks until the queue is under its
+// concurrency limit and at least one worker is assigned to the queue by
+// its weight, or ctx is done.
+func (sjkr *DefaultSQSJkr) reserve(ctx context.Context, q *queue, max int) int {
+	return sjkr.sched.reserve(ctx, q, max)
+}
+
+// unreserve releases n workers reserved for the queue
+func (sjkr *DefaultSQSJkr) unreserve(q *queue, n int) {
+	sjkr.sched.release(q, n)
+}
+
+// backoff returns the duration with jitter to wait before retrying after
+// n consecutive failures.
+func backoff(n int64) time.Duration {
+	d := ReceiveBackoffMax
+	if n < 16 {
+		if exp := ReceiveBackoffBase << uint(n-1); exp < d {
+			d = exp
+		}
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,232 @@
+package sqsjkr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// JobResult is the result of the job published to result sinks
+type JobResult struct {
+	JobID           string    `json:"job_id"`
+	EventID         string    `json:"event_id,omitempty"`
+	Outcome         string    `json:"outcome"`
+	Reason          string    `json:"reason,omitempty"`
+	ExitCode        int       `json:"exit_code"`
+	Duration        float64   `json:"duration"` // seconds
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	Host            string    `json:"host"`
+	Stdout          string    `json:"stdout"`
+	StdoutTruncated bool      `json:"stdout_truncated,omitempty"`
+	Stderr          string    `json:"stderr"`
+	StderrTruncated bool      `json:"stderr_truncated,omitempty"`
+}
+
+// newJobResult build JobResult of the job executed from started to finished
+func newJobResult(job Job, output []byte, err error, started, finished time.Time) *JobResult {
+	host, _ := os.Hostname()
+	jr := &JobResult{
+		JobID:      job.JobID(),
+		EventID:    job.EventID(),
+		Outcome:    outcomeOf(output, err),
+		ExitCode:   exitCode(err),
+		Duration:   finished.Sub(started).Seconds(),
+		StartedAt:  started,
+		FinishedAt: finished,
+		Host:       host,
+	}
+	if err != nil {
+		jr.Reason = err.Error()
+	}
+	if r := result(job); r != nil {
+		jr.Stdout, jr.StdoutTruncated = tail(r.Stdout.Bytes(), r.Stdout.Truncated() > 0)
+		jr.Stderr, jr.StderrTruncated = tail(r.Stderr.Bytes(), r.Stderr.Truncated() > 0)
+	} else {
+		jr.Stdout, jr.StdoutTruncated = tail(output, false)
+	}
+	return jr
+}
+
+// tail returns the last ResultOutputSize bytes of output.
+func tail(output []byte, truncated bool) (string, bool) {
+	if len(output) > ResultOutputSize {
+		return string(output[len(output)-ResultOutputSize:]), true
+	}
+	return string(output), truncated
+}
+
+// outcomeOf returns the outcome of the job by its output and error.
+func outcomeOf(output []byte, err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSucceeded
+	case errors.Is(err, ErrTimedOut):
+		return OutcomeTimedOut
+	case errors.Is(err, ErrLimitExceeded):
+		return OutcomeLimitExceeded
+	case output == nil:
+		return OutcomeFailed
+	default:
+		return OutcomeErrored
+	}
+}
+
+// exitCode returns the exit code of the command by its error. exitCode is
+// -1 if the command did not exit normally.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// ResultSink is the destination of job results
+type ResultSink interface {
+	Send(*JobResult) error
+}
+
+// SQSResultSink sends job results to the SQS queue
+type SQSResultSink struct {
+	SQS  *sqs.SQS
+	qURL string
+}
+
+// NewSQSResultSink build SQSResultSink
+func NewSQSResultSink(q *sqs.SQS, qURL string) *SQSResultSink {
+	return &SQSResultSink{
+		SQS:  q,
+		qURL: qURL,
+	}
+}
+
+// Send sends the result as the message body
+func (s *SQSResultSink) Send(jr *JobResult) error {
+	b, err := json.Marshal(jr)
+	if err != nil {
+		return err
+	}
+
+	params := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(s.qURL),
+		MessageBody: aws.String(string(b)),
+	}
+	_, err = s.SQS.SendMessage(params)
+	return err
+}
+
+// SNSResultSink publishes job results to the SNS topic
+type SNSResultSink struct {
+	SNS      *sns.SNS
+	topicArn string
+}
+
+// NewSNSResultSink build SNSResultSink
+func NewSNSResultSink(s *sns.SNS, topicArn string) *SNSResultSink {
+	return &SNSResultSink{
+		SNS:      s,
+		topicArn: topicArn,
+	}
+}
+
+// Send publishes the result as the message
+func (s *SNSResultSink) Send(jr *JobResult) error {
+	b, err := json.Marshal(jr)
+	if err != nil {
+		return err
+	}
+
+	params := &sns.PublishInput{
+		TopicArn: aws.String(s.topicArn),
+		Message:  aws.String(string(b)),
+	}
+	_, err = s.SNS.Publish(params)
+	return err
+}
+
+// WebhookResultSink posts job results to the HTTP endpoint
+type WebhookResultSink struct {
+	Client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+// NewWebhookResultSink build WebhookResultSink
+func NewWebhookResultSink(url string, headers map[string]string, timeout time.Duration) *WebhookResultSink {
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	return &WebhookResultSink{
+		Client:  &http.Client{Timeout: timeout},
+		url:     url,
+		headers: headers,
+	}
+}
+
+// Send posts the result in JSON
+func (s *WebhookResultSink) Send(jr *JobResult) error {
+	b, err := json.Marshal(jr)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ApplicationJSON)
+	for key, val := range s.headers {
+		req.Header.Set(key, val)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// FileResultSink appends job results to the local file in JSON lines
+type FileResultSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileResultSink build FileResultSink
+func NewFileResultSink(path string) *FileResultSink {
+	return &FileResultSink{path: path}
+}
+
+// Send appends the result to the file
+func (s *FileResultSink) Send(jr *JobResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return appendJSONLine(s.path, jr)
+}
+
+// isQueueURL reports whether reply_to of the message is the url of SQS
+// queue instead of the name of the sink.
+func isQueueURL(replyTo string) bool {
+	return strings.HasPrefix(replyTo, "https://") || strings.HasPrefix(replyTo, "http://")
+}
@@ -0,0 +1,106 @@
+package sqsjkr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPublishResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sjkr := &DefaultSQSJkr{}
+	sjkr.SetResultSink(NewFileResultSink(filepath.Join(dir, "all.jsonl")))
+	sjkr.AddResultSink("local", NewFileResultSink(filepath.Join(dir, "local.jsonl")))
+	w := Worker{
+		ctx:   context.Background(),
+		sjkr:  sjkr,
+		stats: &Stats{busy: make(chan struct{}, 1)},
+	}
+
+	body := `{"command": "echo out; echo err >&2; exit 3", "event_id": "result_event", "reply_to": "local"}`
+	p := &JobParser{ReplyTo: []string{"local"}}
+	job, err := p.NewJob(buildMsg(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	output, err := w.executeJob(job)
+	w.publishResult(newJobResult(job, output, err, started, time.Now()), replyTo(job))
+
+	for _, name := range []string{"all.jsonl", "local.jsonl"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var jr JobResult
+		if err := json.Unmarshal(b, &jr); err != nil {
+			t.Fatal(err)
+		}
+		if jr.JobID != job.JobID() || jr.EventID != "result_event" || jr.Outcome != OutcomeErrored || jr.ExitCode != 3 {
+			t.Errorf("unexpected result in %s: %#v", name, jr)
+		}
+		if jr.Stdout != "out\n" || jr.Stderr != "err\n" {
+			t.Errorf("unexpected output in %s: stdout=%q stderr=%q", name, jr.Stdout, jr.Stderr)
+		}
+	}
+
+	if _, err := sjkr.ResultSinks("undefined"); err == nil {
+		t.Error("unknown reply_to should be error")
+	}
+}
+
+func TestRejectUnknownReplyTo(t *testing.T) {
+	conf := NewConfig()
+	conf.Kicker.AllowedReplyQueues = []string{"https://sqs.ap-northeast-1.amazonaws.com/12345678/replies"}
+	sjkr := NewWithSource(conf, nil)
+	sjkr.AddResultSink("local", NewFileResultSink(os.DevNull))
+	p := sjkr.jobParser()
+
+	for replyTo, allowed := range map[string]bool{
+		"local": true,
+		"https://sqs.ap-northeast-1.amazonaws.com/12345678/replies": true,
+		"https://sqs.ap-northeast-1.amazonaws.com/87654321/steal":   false,
+		"undefined": false,
+	} {
+		body := fmt.Sprintf(`{"command": "echo secret", "reply_to": %q}`, replyTo)
+		if _, err := p.NewJob(buildMsg(body)); (err == nil) != allowed {
+			t.Errorf("unexpected result of reply_to %s: allowed=%t, err=%v", replyTo, allowed, err)
+		}
+	}
+}
+
+func TestWebhookResultSink(t *testing.T) {
+	var jr JobResult
+	var token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&jr)
+	}))
+	defer ts.Close()
+
+	s := NewWebhookResultSink(ts.URL, map[string]string{"Authorization": "Bearer secret"}, 0)
+	if err := s.Send(&JobResult{JobID: "msg-1", Outcome: OutcomeSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+	if jr.JobID != "msg-1" || jr.Outcome != OutcomeSucceeded || token != "Bearer secret" {
+		t.Errorf("unexpected request: %#v, token=%s", jr, token)
+	}
+
+	s = NewWebhookResultSink(ts.URL+"/notfound", nil, 0)
+	ts.Config.Handler = http.NotFoundHandler()
+	if err := s.Send(&JobResult{}); err == nil {
+		t.Error("webhook should fail by 404")
+	}
+}
@@ -0,0 +1,72 @@
+package sqsjkr
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// RetryPolicy is the policy to retry failed jobs by redelivery of their
+// messages. The job is retried when MaxRetries is greater than 0.
+type RetryPolicy struct {
+	MaxRetries       int      `json:"max_retries,omitempty" toml:"max_retries"`
+	RetryBackoff     Duration `json:"retry_backoff,omitempty" toml:"retry_backoff"`
+	RetryOnExitCodes []int    `json:"retry_on_exit_codes,omitempty" toml:"retry_on_exit_codes"`
+}
+
+// merge returns the policy whose unset fields are filled by d
+func (p RetryPolicy) merge(d RetryPolicy) RetryPolicy {
+	if p.MaxRetries == 0 {
+		p.MaxRetries = d.MaxRetries
+	}
+	if p.RetryBackoff.Duration == 0 {
+		p.RetryBackoff = d.RetryBackoff
+	}
+	if len(p.RetryOnExitCodes) == 0 {
+		p.RetryOnExitCodes = d.RetryOnExitCodes
+	}
+	return p
+}
+
+// enabled reports whether the policy retries failed jobs
+func (p RetryPolicy) enabled() bool {
+	return p.MaxRetries > 0
+}
+
+// retryable reports whether the job failed by err at the attempt should
+// be retried.
+func (p RetryPolicy) retryable(err error, attempt int64) bool {
+	if attempt > int64(p.MaxRetries) {
+		return false
+	}
+	if len(p.RetryOnExitCodes) == 0 {
+		return true
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	for _, code := range p.RetryOnExitCodes {
+		if code == exitErr.ExitCode() {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the delay before the next attempt, which is doubled every
+// attempt.
+func (p RetryPolicy) delay(attempt int64) time.Duration {
+	d := p.RetryBackoff.Duration
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	for i := int64(1); i < attempt && d < MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > MaxRetryBackoff {
+		d = MaxRetryBackoff
+	}
+	return d
+}
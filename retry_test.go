@@ -0,0 +1,102 @@
+package sqsjkr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	conf, err := LoadConfig("./test/jobs.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := conf.Jobs["nightly-report"].RetryPolicy.merge(conf.Kicker.RetryPolicy)
+	if p.MaxRetries != 3 || p.RetryBackoff.Duration != 30*time.Second || len(p.RetryOnExitCodes) != 1 {
+		t.Fatalf("unexpected retry policy: %#v", p)
+	}
+
+	exit75 := exec.Command("sh", "-c", "exit 75").Run()
+	exit1 := exec.Command("sh", "-c", "exit 1").Run()
+	if !p.retryable(exit75, 1) || !p.retryable(exit75, 3) {
+		t.Error("job exited with 75 should be retried")
+	}
+	if p.retryable(exit75, 4) {
+		t.Error("job should not be retried over max_retries")
+	}
+	if p.retryable(exit1, 1) || p.retryable(errors.New("failed"), 1) {
+		t.Error("job exited with other codes should not be retried")
+	}
+
+	for attempt, expected := range map[int64]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 20: MaxRetryBackoff} {
+		if d := p.delay(attempt); d != expected {
+			t.Errorf("unexpected delay of attempt %d: got=%s, expected=%s", attempt, d, expected)
+		}
+	}
+}
+
+func TestRetryJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	attempts := filepath.Join(dir, "attempts")
+	body, _ := json.Marshal(map[string]interface{}{
+		"command":             fmt.Sprintf("echo $SQSJKR_ATTEMPT >> %s; exit 3", attempts),
+		"max_retries":         2,
+		"retry_backoff":       "10ms",
+		"retry_on_exit_codes": []int{3},
+	})
+	path := filepath.Join(dir, "jobs.jsonl")
+	if err := ioutil.WriteFile(path, append(body, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.SetConcurrentNum(1)
+	conf.SetStatsSocket(filepath.Join(dir, "sqsjkr.sock"))
+	conf.File.Path = path
+	deadLetter := filepath.Join(dir, "dead_letter.jsonl")
+
+	src := NewFileSource(path, time.Minute)
+	src.PollInterval = 10 * time.Millisecond
+	sjkr := NewWithSource(conf, src)
+	sjkr.SetDeadLetterQueue(NewFileDeadLetterQueue(deadLetter))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, sjkr, "info")
+	}()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(deadLetter); err == nil {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("job was not sent to dead letter")
+		}
+	}
+	cancel()
+	<-done
+
+	b, err := ioutil.ReadFile(attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1\n2\n3\n" {
+		t.Errorf("job should be retried twice: %q", b)
+	}
+	if len(src.inflight) != 0 {
+		t.Errorf("message should be deleted after retries: %v", src.inflight)
+	}
+}
@@ -0,0 +1,135 @@
+package sqsjkr
+
+import (
+	"context"
+	"sync"
+)
+
+// scheduler assigns idle workers to queues. While queues wait for workers,
+// the next queue is picked by stride scheduling of their weights, so each
+// queue gets workers in proportion to its weight even when all workers are
+// busy.
+type scheduler struct {
+	mu      sync.Mutex
+	idle    int
+	pass    float64 // pass of the queue which was assigned last
+	waiting []*reservation
+}
+
+// reservation is the request of workers from the queue
+type reservation struct {
+	q     *queue
+	max   int
+	n     int // the number of assigned workers
+	ready chan struct{}
+}
+
+func newScheduler(workers int) *scheduler {
+	return &scheduler{idle: workers}
+}
+
+// reserve reserves workers for the queue up to max, and returns the number
+// of reserved workers. reserve blocks until workers are assigned to the
+// queue, or returns 0 when ctx is done.
+func (s *scheduler) reserve(ctx context.Context, q *queue, max int) int {
+	s.mu.Lock()
+	// the queue which has been idle doesn't take over workers by its
+	// old pass
+	if q.pass < s.pass {
+		q.pass = s.pass
+	}
+	r := &reservation{q: q, max: max, ready: make(chan struct{})}
+	s.waiting = append(s.waiting, r)
+	s.assign()
+	s.mu.Unlock()
+
+	select {
+	case <-r.ready:
+		return r.n
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.n > 0 {
+		// assigned while ctx was done
+		s.refund(q, r.n)
+		return 0
+	}
+	for i, w := range s.waiting {
+		if w == r {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			break
+		}
+	}
+	return 0
+}
+
+// release releases n workers which ran jobs of the queue.
+func (s *scheduler) release(q *queue, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idle += n
+	q.running -= n
+	s.assign()
+}
+
+// take takes a worker for the queue even if no workers are idle. The job
+// of a message group takes the worker which finished the previous job of
+// the group, and the worker may have been assigned to other queues in the
+// meantime, so idle can be negative until one of them is released.
+func (s *scheduler) take(q *queue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idle--
+	q.running++
+	q.pass += 1 / float64(q.weight)
+}
+
+// cancel releases n workers which were reserved but ran no jobs. The queue
+// is not charged for them.
+func (s *scheduler) cancel(q *queue, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refund(q, n)
+}
+
+func (s *scheduler) refund(q *queue, n int) {
+	s.idle += n
+	q.running -= n
+	q.pass -= float64(n) / float64(q.weight)
+	s.assign()
+}
+
+// assign assigns idle workers to the waiting queues in order of their pass.
+func (s *scheduler) assign() {
+	for s.idle > 0 {
+		next := -1
+		for i, r := range s.waiting {
+			if r.q.limit > 0 && r.q.running >= r.q.limit {
+				continue
+			}
+			if next < 0 || r.q.pass < s.waiting[next].q.pass {
+				next = i
+			}
+		}
+		if next < 0 {
+			return
+		}
+
+		r := s.waiting[next]
+		s.waiting = append(s.waiting[:next], s.waiting[next+1:]...)
+		r.n = r.max
+		if r.n > s.idle {
+			r.n = s.idle
+		}
+		if r.q.limit > 0 && r.n > r.q.limit-r.q.running {
+			r.n = r.q.limit - r.q.running
+		}
+		s.idle -= r.n
+		r.q.running += r.n
+		s.pass = r.q.pass
+		r.q.pass += float64(r.n) / float64(r.q.weight)
+		close(r.ready)
+	}
+}
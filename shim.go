@@ -0,0 +1,114 @@
+package sqsjkr
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// shimEnv is the environment variable of the shim which sets up its
+	// own process and executes the command. The value is the comma
+	// separated list of settings, e.g. "wait,umask=27,nofile=64".
+	shimEnv  = "SQSJKR_SHIM"
+	shimName = "sqsjkr-shim"
+)
+
+func init() {
+	if spec, ok := os.LookupEnv(shimEnv); ok {
+		runShim(spec)
+	}
+}
+
+// wrapShim makes cmd start sqsjkr itself as the shim which applies spec to
+// its process and executes the command. Settings are applied between fork
+// and exec of the command, so sqsjkr never changes its own process.
+func wrapShim(cmd *exec.Cmd, spec []string) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	exe := "/proc/self/exe"
+	if runtime.GOOS != "linux" {
+		var err error
+		if exe, err = os.Executable(); err != nil {
+			return err
+		}
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", shimEnv, strings.Join(spec, ",")))
+	cmd.Args = append([]string{shimName, cmd.Path}, cmd.Args...)
+	cmd.Path = exe
+	return nil
+}
+
+// runShim runs in the process started by wrapShim. It waits for sqsjkr to
+// let it go by fd 3 if spec has "wait", applies umask and rlimits of spec,
+// and executes the command of os.Args[1:]. The shim never returns.
+func runShim(spec string) {
+	os.Unsetenv(shimEnv)
+	fail := func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, shimName+": "+format+"\n", args...)
+		os.Exit(127)
+	}
+	if len(os.Args) < 3 {
+		fail("command undefined")
+	}
+
+	type rlimit struct {
+		name string
+		v    uint64
+	}
+	wait, umask := false, -1
+	var rlimits []rlimit
+	for _, s := range strings.Split(spec, ",") {
+		kv := strings.SplitN(s, "=", 2)
+		switch {
+		case kv[0] == "wait":
+			wait = true
+		case len(kv) != 2:
+			fail("invalid setting %q", s)
+		case kv[0] == "umask":
+			m, err := strconv.ParseUint(kv[1], 8, 32)
+			if err != nil {
+				fail("invalid umask %s", kv[1])
+			}
+			umask = int(m)
+		default:
+			v, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				fail("invalid rlimit %s", s)
+			}
+			rlimits = append(rlimits, rlimit{name: kv[0], v: v})
+		}
+	}
+
+	if wait {
+		// sqsjkr closes the pipe without writing if it failed
+		ready := os.NewFile(3, "ready")
+		b := make([]byte, 1)
+		if n, _ := ready.Read(b); n != 1 {
+			fail("could not apply resource limits")
+		}
+		ready.Close()
+	}
+	if umask >= 0 {
+		syscall.Umask(umask)
+	}
+	// rlimits are applied at last, the shim may not allocate memory after
+	// RLIMIT_AS is applied
+	env := os.Environ()
+	for _, r := range rlimits {
+		if err := setRlimit(r.name, r.v); err != nil {
+			fail("failed to set rlimit %s=%d: %s", r.name, r.v, err)
+		}
+	}
+
+	err := syscall.Exec(os.Args[1], os.Args[2:], env)
+	fail("failed to execute %s: %s", os.Args[1], err)
+}
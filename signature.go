@@ -0,0 +1,89 @@
+package sqsjkr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Names of message attributes of the signature
+const (
+	SignatureAttribute        = "sqsjkr-signature"
+	PayloadSignatureAttribute = "sqsjkr-payload-signature"
+	KeyIDAttribute            = "sqsjkr-key-id"
+)
+
+// KeyRing is the set of HMAC keys by key id
+type KeyRing map[string][]byte
+
+// Sign returns HMAC-SHA256 of body by key in hex
+func Sign(key []byte, body string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignMessage sets the signature of the message body to the message
+// attributes of input
+func SignMessage(input *sqs.SendMessageInput, keyID string, key []byte) {
+	if input.MessageAttributes == nil {
+		input.MessageAttributes = map[string]*sqs.MessageAttributeValue{}
+	}
+	input.MessageAttributes[KeyIDAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(keyID),
+	}
+	input.MessageAttributes[SignatureAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(Sign(key, aws.StringValue(input.MessageBody))),
+	}
+}
+
+// SignPayload sets the signature of the payload in the object store to the
+// message attributes of input. The message body of input is the pointer to
+// the payload, and it is also signed by SignMessage.
+func SignPayload(input *sqs.SendMessageInput, keyID string, key []byte, payload []byte) {
+	SignMessage(input, keyID, key)
+	input.MessageAttributes[PayloadSignatureAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(Sign(key, string(payload))),
+	}
+}
+
+// Verify verifies the signature of the message body by the key of the key
+// id in the message attributes.
+func (kr KeyRing) Verify(msg *Message) error {
+	return kr.verify(msg, SignatureAttribute, msg.Body)
+}
+
+// VerifyPayload verifies the signature of the payload which the message
+// points to by the key of the key id in the message attributes.
+func (kr KeyRing) VerifyPayload(msg *Message, payload string) error {
+	return kr.verify(msg, PayloadSignatureAttribute, payload)
+}
+
+func (kr KeyRing) verify(msg *Message, attr, body string) error {
+	sig, ok := msg.MessageAttributes[attr]
+	if !ok {
+		return ErrUnsigned
+	}
+	keyID := msg.MessageAttributes[KeyIDAttribute]
+	key, ok := kr[keyID]
+	if !ok {
+		return fmt.Errorf("%w: unknown key id %q", ErrInvalidSignature, keyID)
+	}
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package sqsjkr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestVerifySignature(t *testing.T) {
+	kr := KeyRing{"key1": []byte("secret1")}
+	input := &sqs.SendMessageInput{
+		MessageBody: aws.String(`{"command":"echo hello"}`),
+	}
+	SignMessage(input, "key1", []byte("secret1"))
+	msg := newMessage(&sqs.Message{
+		MessageId:         aws.String("msg-1"),
+		Body:              input.MessageBody,
+		MessageAttributes: input.MessageAttributes,
+	})
+
+	if err := kr.Verify(msg); err != nil {
+		t.Errorf("signed message should be verified: %s", err)
+	}
+
+	tampered := *msg
+	tampered.Body = `{"command":"rm -rf /"}`
+	if err := kr.Verify(&tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered message should be invalid: %v", err)
+	}
+
+	if err := (KeyRing{"key2": []byte("secret1")}).Verify(msg); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("message signed by unknown key should be invalid: %v", err)
+	}
+
+	if err := kr.Verify(&Message{ID: "msg-2", Body: *input.MessageBody}); err != ErrUnsigned {
+		t.Errorf("message without signature should be unsigned: %v", err)
+	}
+}
+
+func TestRejectUnsignedMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jobs.jsonl")
+	if err := ioutil.WriteFile(path, []byte(`{"command": "true"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.SetConcurrentNum(1)
+	conf.Signature.Required = true
+	conf.Signature.Keys = []SignatureKey{{ID: "key1", Secret: "secret1"}}
+	src := NewFileSource(path, time.Minute)
+	sjkr := NewWithSource(conf, src)
+	sjkr.SetDeadLetterQueue(NewFileDeadLetterQueue(filepath.Join(dir, "dead_letter.jsonl")))
+	sjkr.sched = newScheduler(1)
+	q := sjkr.queues[0]
+
+	msgs, err := src.Receive(context.Background(), 1)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("failed to receive message: %v, %s", msgs, err)
+	}
+	sjkr.reserve(context.Background(), q, 1)
+	sjkr.dispatch(context.Background(), q, msgs[0])
+
+	if len(src.inflight) != 0 || sjkr.sched.idle != 1 {
+		t.Error("rejected message should be deleted")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "dead_letter.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dl DeadLetter
+	if err := json.Unmarshal(b, &dl); err != nil {
+		t.Fatal(err)
+	}
+	if dl.Outcome != OutcomeRejected || dl.Reason != ErrUnsigned.Error() {
+		t.Errorf("unexpected dead letter: %#v", dl)
+	}
+}
+
+func TestVerifyPayloadSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "bucket"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"command":"echo large"}`)
+	object := filepath.Join(dir, "bucket", "large.json")
+	if err := ioutil.WriteFile(object, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := &sqs.SendMessageInput{
+		MessageBody: aws.String(`["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"large.json"}]`),
+	}
+	SignPayload(input, "key1", []byte("secret1"), payload)
+	signed := newMessage(&sqs.Message{
+		MessageId:         aws.String("msg-1"),
+		Body:              input.MessageBody,
+		MessageAttributes: input.MessageAttributes,
+		Attributes:        map[string]*string{"SentTimestamp": aws.String("1523261130000")},
+	})
+
+	p := &JobParser{
+		Store:             NewFileObjectStore(dir),
+		KeyRing:           KeyRing{"key1": []byte("secret1")},
+		SignatureRequired: true,
+	}
+	if err := p.KeyRing.Verify(signed); err != nil {
+		t.Errorf("pointer message should be verified: %s", err)
+	}
+	if _, err := p.parse(signed); err != nil {
+		t.Errorf("signed payload should be verified: %s", err)
+	}
+
+	// the signature of the pointer doesn't cover the payload
+	unsigned := *signed
+	unsigned.MessageAttributes = map[string]string{
+		KeyIDAttribute:     signed.MessageAttributes[KeyIDAttribute],
+		SignatureAttribute: signed.MessageAttributes[SignatureAttribute],
+	}
+	if _, err := p.parse(&unsigned); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned payload should be rejected: %v", err)
+	}
+
+	if err := ioutil.WriteFile(object, []byte(`{"command":"rm -rf /"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.parse(signed); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered payload should be invalid: %v", err)
+	}
+}
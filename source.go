@@ -0,0 +1,47 @@
+package sqsjkr
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Message is the message received from MessageSource. Attributes have the
+// same names as SQS message system attributes (e.g. SentTimestamp).
+type Message struct {
+	ID                string
+	Body              string
+	ReceiptHandle     string
+	Attributes        map[string]string
+	MessageAttributes map[string]string
+}
+
+// MessageSource is the transport of job messages
+type MessageSource interface {
+	// Receive receives messages up to max.
+	Receive(ctx context.Context, max int) ([]*Message, error)
+	// Ack deletes the message from the source.
+	Ack(*Message) error
+	// Nack leaves the message in the source to be redelivered after its
+	// visibility timeout.
+	Nack(*Message) error
+	// Extend changes the visibility timeout of the message.
+	Extend(*Message, time.Duration) error
+}
+
+// SentTimestamp returns the time when the message was sent
+func (m *Message) SentTimestamp() (time.Time, error) {
+	ts, err := strconv.ParseInt(m.Attributes[sqs.MessageSystemAttributeNameSentTimestamp], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts/1000, ts%1000*int64(time.Millisecond)), nil
+}
+
+// ReceiveCount returns the number of times the message has been received
+func (m *Message) ReceiveCount() int64 {
+	n, _ := strconv.ParseInt(m.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount], 10, 64)
+	return n
+}
@@ -0,0 +1,96 @@
+package sqsjkr
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SQSSource is the MessageSource which receives messages from SQS
+type SQSSource struct {
+	SQS               *sqs.SQS
+	QueueURL          string
+	VisibilityTimeout time.Duration
+	WaitTime          time.Duration // 0 for short polling
+}
+
+// NewSQSSource build SQSSource
+func NewSQSSource(q *sqs.SQS, qURL string, visibilityTimeout time.Duration) *SQSSource {
+	return &SQSSource{
+		SQS:               q,
+		QueueURL:          qURL,
+		VisibilityTimeout: visibilityTimeout,
+		WaitTime:          WaitTimeSec * time.Second,
+	}
+}
+
+// Receive receives messages from SQS by long polling for WaitTime
+func (s *SQSSource) Receive(ctx context.Context, max int) ([]*Message, error) {
+	params := &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(s.QueueURL),
+		MaxNumberOfMessages:   aws.Int64(int64(max)),
+		VisibilityTimeout:     aws.Int64(int64(s.VisibilityTimeout / time.Second)),
+		WaitTimeSeconds:       aws.Int64(int64(s.WaitTime / time.Second)),
+		MessageAttributeNames: aws.StringSlice([]string{"All"}),
+		AttributeNames:        aws.StringSlice([]string{"All"}),
+	}
+
+	resp, err := s.SQS.ReceiveMessageWithContext(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*Message, 0, len(resp.Messages))
+	for _, msg := range resp.Messages {
+		logger.Debugf("[msg_id:%s] md5body:%s", aws.StringValue(msg.MessageId), aws.StringValue(msg.MD5OfBody))
+		msgs = append(msgs, newMessage(msg))
+	}
+	return msgs, nil
+}
+
+// Ack deletes the message from SQS
+func (s *SQSSource) Ack(msg *Message) error {
+	params := &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(s.QueueURL),
+		ReceiptHandle: aws.String(msg.ReceiptHandle),
+	}
+
+	_, err := s.SQS.DeleteMessage(params)
+	return err
+}
+
+// Nack does nothing, SQS redelivers the message after the visibility timeout.
+func (s *SQSSource) Nack(msg *Message) error {
+	return nil
+}
+
+// Extend changes the visibility timeout of the message
+func (s *SQSSource) Extend(msg *Message, timeout time.Duration) error {
+	params := &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(s.QueueURL),
+		ReceiptHandle:     aws.String(msg.ReceiptHandle),
+		VisibilityTimeout: aws.Int64(int64(timeout / time.Second)),
+	}
+
+	_, err := s.SQS.ChangeMessageVisibility(params)
+	return err
+}
+
+// newMessage converts the SQS message to Message
+func newMessage(msg *sqs.Message) *Message {
+	m := &Message{
+		ID:                aws.StringValue(msg.MessageId),
+		Body:              aws.StringValue(msg.Body),
+		ReceiptHandle:     aws.StringValue(msg.ReceiptHandle),
+		Attributes:        aws.StringValueMap(msg.Attributes),
+		MessageAttributes: make(map[string]string, len(msg.MessageAttributes)),
+	}
+	for name, attr := range msg.MessageAttributes {
+		if attr.StringValue != nil {
+			m.MessageAttributes[name] = *attr.StringValue
+		}
+	}
+	return m
+}
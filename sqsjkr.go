@@ -8,14 +8,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/kayac/sqsjkr/lock"
 	"github.com/kayac/sqsjkr/throttle"
@@ -38,12 +42,19 @@ var TrapSignals = []os.Signal{
 type DefaultSQSJkr struct {
 	SQS             *sqs.SQS
 	RetentionPeriod time.Duration
-	qURL            string
-	recvParams      *sqs.ReceiveMessageInput
+	queues          []*queue
 	jobs            chan Job
 	locker          lock.Locker
 	throttler       throttle.Throttler
+	deadLetter      DeadLetterQueue
+	resultSink      ResultSink
+	sinks           map[string]ResultSink
+	history         *History
+	metrics         metricsHooks
+	store           ObjectStore
 	conf            *Config
+	sched           *scheduler
+	groups          *groupQueue
 }
 
 // StatsItem struct
@@ -59,14 +70,47 @@ type Stats struct {
 		Idle int64 `json:"idle"`
 	} `json:"workers"`
 	Invocations struct {
-		Succeeded int64 `json:"succeeded"`
-		Failed    int64 `json:"failed"`
-		Errored   int64 `json:"errored"`
+		Succeeded     int64 `json:"succeeded"`
+		Failed        int64 `json:"failed"`
+		Errored       int64 `json:"errored"`
+		TimedOut      int64 `json:"timed_out"`
+		LimitExceeded int64 `json:"limit_exceeded"`
 	} `json:"invocations"`
+	Receiver struct {
+		Status              string `json:"status"`
+		ConsecutiveFailures int64  `json:"consecutive_failures"`
+	} `json:"receiver"`
+	Queues map[string]*QueueStats `json:"queues,omitempty"`
 
 	busy chan struct{}
 }
 
+// Healthy reports whether receiving messages has not been failed
+// successively.
+func (s *Stats) Healthy() bool {
+	return s.consecutiveFailures() < DegradedFailureNum
+}
+
+// consecutiveFailures returns the max number of consecutive failures to
+// receive messages of all queues.
+func (s *Stats) consecutiveFailures() int64 {
+	n := atomic.LoadInt64(&s.Receiver.ConsecutiveFailures)
+	for _, qs := range s.Queues {
+		if f := atomic.LoadInt64(&qs.ConsecutiveFailures); f > n {
+			n = f
+		}
+	}
+	return n
+}
+
+// status returns the receiver status
+func (s *Stats) status() string {
+	if s.Healthy() {
+		return StatusHealthy
+	}
+	return StatusDegraded
+}
+
 // SQSJkr interfaces
 type SQSJkr interface {
 	Run(context.Context) error
@@ -80,19 +124,28 @@ type SQSJkr interface {
 
 // Run sqsjkr daemon
 func (sjkr *DefaultSQSJkr) Run(ctx context.Context) error {
+	sjkr.sched = newScheduler(sjkr.conf.Kicker.MaxConcurrentNum)
+	sjkr.groups = newGroupQueue(ctx)
 
-	sjkr.recvParams = &sqs.ReceiveMessageInput{
-		QueueUrl:              aws.String(sjkr.qURL),
-		MaxNumberOfMessages:   aws.Int64(MaxRetrieveMessageNum),
-		VisibilityTimeout:     aws.Int64(VisibilityTimeout),
-		WaitTimeSeconds:       aws.Int64(WaitTimeSec),
-		MessageAttributeNames: aws.StringSlice([]string{"All"}),
-		AttributeNames:        aws.StringSlice([]string{"All"}),
+	wg := new(sync.WaitGroup)
+	for _, q := range sjkr.queues {
+		wg.Add(1)
+		go func(q *queue) {
+			sjkr.poll(ctx, q)
+			wg.Done()
+		}(q)
 	}
+	wg.Wait()
 
-	err := sjkr.receiveMessage(ctx)
+	// the waiting jobs of message groups never start after ctx is done,
+	// and are released
+	for _, job := range sjkr.groups.drain() {
+		job.(*QueuedJob).release()
+	}
 
-	return err
+	logger.Infof("cancel sqsjkr context")
+	close(sjkr.jobs)
+	return nil
 }
 
 // Config return SQSJkr config
@@ -105,54 +158,18 @@ func (sjkr *DefaultSQSJkr) JobStream() chan Job {
 	return sjkr.jobs
 }
 
-// DeleteMessage delete message from SQS
-func (sjkr *DefaultSQSJkr) deleteMessage(msg *sqs.Message) error {
-	params := &sqs.DeleteMessageInput{
-		QueueUrl:      aws.String(sjkr.qURL),
-		ReceiptHandle: msg.ReceiptHandle,
-	}
-
-	_, err := sjkr.SQS.DeleteMessage(params)
-	if err != nil {
-		return err
-	}
-
-	return nil
+// Source return DefaultSQSJkr's MessageSource of the first queue
+func (sjkr *DefaultSQSJkr) Source() MessageSource {
+	return sjkr.queues[0].source
 }
 
-func (sjkr *DefaultSQSJkr) receiveMessage(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			logger.Infof("cancel sqsjkr context")
-			close(sjkr.jobs)
-			return nil
-		default:
-			resp, err := sjkr.SQS.ReceiveMessage(sjkr.recvParams)
-			if err != nil {
-				logger.Errorf(err.Error())
-			}
-
-			for _, msg := range resp.Messages {
-				logger.Debugf("[msg_id:%s] body:%#v, md5body:%s",
-					*msg.MessageId, *msg.Body, *msg.MD5OfBody)
-				logger.Debugf("[attributes] sender_id:%s, sent_time_stamp:%s, appx_1st_recv_time:%s, appx_recv_cnt:%s",
-					*msg.Attributes["SenderId"],
-					*msg.Attributes["SentTimestamp"],
-					*msg.Attributes["ApproximateFirstReceiveTimestamp"],
-					*msg.Attributes["ApproximateReceiveCount"],
-				)
-
-				job, err := NewJob(msg, sjkr.conf.Kicker.Trigger)
-				if err == nil {
-					sjkr.jobs <- job
-				} else {
-					logger.Errorf(err.Error())
-				}
-
-				sjkr.deleteMessage(msg)
-			}
-		}
+// SetStats set stats to report the receiver status and stats of queues
+func (sjkr *DefaultSQSJkr) SetStats(s *Stats) {
+	if s.Queues == nil {
+		s.Queues = make(map[string]*QueueStats, len(sjkr.queues))
+	}
+	for _, q := range sjkr.queues {
+		s.Queues[q.name] = q.stats
 	}
 }
 
@@ -176,15 +193,113 @@ func (sjkr *DefaultSQSJkr) Throttler() throttle.Throttler {
 	return sjkr.throttler
 }
 
+// SetDeadLetterQueue set DefaultSQSJkr's DeadLetterQueue
+func (sjkr *DefaultSQSJkr) SetDeadLetterQueue(dq DeadLetterQueue) {
+	sjkr.deadLetter = dq
+}
+
+// DeadLetterQueue return DefaultSQSJkr's DeadLetterQueue
+func (sjkr *DefaultSQSJkr) DeadLetterQueue() DeadLetterQueue {
+	return sjkr.deadLetter
+}
+
+// SetResultSink set DefaultSQSJkr's ResultSink which receives results of
+// all jobs
+func (sjkr *DefaultSQSJkr) SetResultSink(rs ResultSink) {
+	sjkr.resultSink = rs
+}
+
+// AddResultSink adds ResultSink which messages can reply to by name
+func (sjkr *DefaultSQSJkr) AddResultSink(name string, rs ResultSink) {
+	if sjkr.sinks == nil {
+		sjkr.sinks = map[string]ResultSink{}
+	}
+	sjkr.sinks[name] = rs
+}
+
+// ResultSinks returns the sinks which the result of the job replying to
+// replyTo is sent to. replyTo is the name of the sink or the url of SQS
+// queue in allowed_reply_queues.
+func (sjkr *DefaultSQSJkr) ResultSinks(replyTo string) ([]ResultSink, error) {
+	var sinks []ResultSink
+	if sjkr.resultSink != nil {
+		sinks = append(sinks, sjkr.resultSink)
+	}
+	if replyTo == "" {
+		return sinks, nil
+	}
+	if rs, ok := sjkr.sinks[replyTo]; ok {
+		return append(sinks, rs), nil
+	}
+	if isQueueURL(replyTo) && sjkr.SQS != nil && sjkr.conf != nil && contains(sjkr.conf.Kicker.AllowedReplyQueues, replyTo) {
+		return append(sinks, NewSQSResultSink(sjkr.SQS, replyTo)), nil
+	}
+	return sinks, fmt.Errorf("unknown reply_to %s", replyTo)
+}
+
+// replyTo returns the names of sinks and the urls of SQS queues which
+// messages can reply to
+func (sjkr *DefaultSQSJkr) replyTo() []string {
+	targets := make([]string, 0, len(sjkr.sinks)+len(sjkr.conf.Kicker.AllowedReplyQueues))
+	for name := range sjkr.sinks {
+		targets = append(targets, name)
+	}
+	return append(targets, sjkr.conf.Kicker.AllowedReplyQueues...)
+}
+
+// SetHistory set DefaultSQSJkr's History which records job runs
+func (sjkr *DefaultSQSJkr) SetHistory(h *History) {
+	sjkr.history = h
+}
+
+// History return DefaultSQSJkr's History
+func (sjkr *DefaultSQSJkr) History() *History {
+	return sjkr.history
+}
+
+// AddMetricsHook adds MetricsHook which is notified of events of jobs and
+// queues
+func (sjkr *DefaultSQSJkr) AddMetricsHook(h MetricsHook) {
+	sjkr.metrics = append(sjkr.metrics, h)
+}
+
+// MetricsHook returns the hook which notifies events to all added hooks
+func (sjkr *DefaultSQSJkr) MetricsHook() MetricsHook {
+	return sjkr.metrics
+}
+
+// SetObjectStore set DefaultSQSJkr's ObjectStore of large payloads
+func (sjkr *DefaultSQSJkr) SetObjectStore(store ObjectStore) {
+	sjkr.store = store
+}
+
+// jobParser returns JobParser by the config
+func (sjkr *DefaultSQSJkr) jobParser() *JobParser {
+	return &JobParser{
+		Trigger:           sjkr.conf.Kicker.Trigger,
+		Store:             sjkr.store,
+		DeletePayload:     sjkr.conf.Payload.DeleteOnSuccess,
+		Jobs:              sjkr.conf.Jobs,
+		Strict:            sjkr.conf.Kicker.StrictJobs,
+		Retry:             sjkr.conf.Kicker.RetryPolicy,
+		AllowedUsers:      sjkr.conf.Kicker.AllowedUsers,
+		AllowedGroups:     sjkr.conf.Kicker.AllowedGroups,
+		AllowedWorkdirs:   sjkr.conf.Kicker.AllowedWorkdirs,
+		ReplyTo:           sjkr.replyTo(),
+		KeyRing:           sjkr.conf.Signature.keyRing(),
+		SignatureRequired: sjkr.conf.Signature.Required,
+		Shell:             sjkr.conf.Kicker.Shell,
+		Limits:            sjkr.conf.Kicker.ResourceLimits,
+		CgroupRoot:        sjkr.conf.Kicker.CgroupRoot,
+		OutputHeadSize:    int(sjkr.conf.Kicker.OutputHeadSize),
+		OutputTailSize:    int(sjkr.conf.Kicker.OutputTailSize),
+		Timeout:           sjkr.conf.Kicker.Timeout.Duration,
+		KillTimeout:       sjkr.conf.Kicker.killTimeout(),
+	}
+}
+
 // New DefaultSQSJkr
 func New(c *Config) (*DefaultSQSJkr, error) {
-	// set queue url
-	qURL := fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s",
-		c.Account.Region,
-		c.Account.ID,
-		c.SQS.QueueName,
-	)
-
 	// initialize SQS
 	var q *sqs.SQS
 	var awsConf *aws.Config
@@ -199,36 +314,159 @@ func New(c *Config) (*DefaultSQSJkr, error) {
 			Region: &c.Account.Region,
 		}
 	}
-	q = sqs.New(session.New(), awsConf)
+	sess := session.New()
+	sqsConf := awsConf.Copy()
+	if c.SQS.Endpoint != "" {
+		sqsConf.Endpoint = aws.String(c.SQS.Endpoint)
+	}
+	q = sqs.New(sess, sqsConf)
+
+	// object store of large payloads
+	var store ObjectStore
+	if c.Payload.Directory != "" {
+		store = NewFileObjectStore(c.Payload.Directory)
+	} else {
+		s3Conf := awsConf.Copy()
+		if c.Payload.Endpoint != "" {
+			s3Conf.Endpoint = aws.String(c.Payload.Endpoint)
+			s3Conf.S3ForcePathStyle = aws.Bool(true)
+		}
+		store = NewS3ObjectStore(s3.New(sess, s3Conf))
+	}
+
+	// message sources
+	var queues []*queue
+	var rperiod time.Duration
+	if c.File.Path != "" {
+		src := NewFileSource(c.File.Path, c.SQS.visibilityTimeout())
+		queues = append(queues, newQueue(filepath.Base(c.File.Path), src, 1, 0))
+	} else {
+		for _, qc := range c.SQS.queues() {
+			// set queue url
+			qURL, err := resolveQueueURL(q, c.Account, qc.Name, qc.QueueURL)
+			if err != nil {
+				return nil, err
+			}
+
+			// retrives SQS queue attributes
+			input := &sqs.GetQueueAttributesInput{
+				AttributeNames: aws.StringSlice([]string{"All"}),
+				QueueUrl:       aws.String(qURL),
+			}
+			attrs, err := q.GetQueueAttributes(input)
+			if err != nil {
+				return nil, err
+			}
+
+			// parse a value of message retention period
+			strVal := *attrs.Attributes[sqs.QueueAttributeNameMessageRetentionPeriod]
+			sec, err := strconv.ParseInt(strVal, 10, 64)
+			if err != nil {
+				logger.Errorf("%s", err.Error())
+				return nil, err
+			}
+			if period := time.Second * time.Duration(sec); period > rperiod {
+				rperiod = period
+			}
+
+			src := NewSQSSource(q, qURL, c.SQS.visibilityTimeout())
+			if len(c.SQS.queues()) > 1 {
+				// doesn't keep workers reserved for the empty queue
+				// while other queues have messages
+				src.WaitTime = 0
+			}
+			queues = append(queues, newQueue(qc.name(), src, qc.Weight, qc.MaxConcurrentNum))
+		}
+	}
 
-	// retrives SQS queue attributes
-	input := &sqs.GetQueueAttributesInput{
-		AttributeNames: aws.StringSlice([]string{"All"}),
-		QueueUrl:       aws.String(qURL),
+	// dead letter destination
+	var dq DeadLetterQueue
+	if c.DeadLetter.QueueName != "" || c.DeadLetter.QueueURL != "" {
+		dqURL, err := resolveQueueURL(q, c.Account, c.DeadLetter.QueueName, c.DeadLetter.QueueURL)
+		if err != nil {
+			return nil, err
+		}
+		dq = NewSQSDeadLetterQueue(q, dqURL)
+	} else if c.DeadLetter.File != "" {
+		dq = NewFileDeadLetterQueue(c.DeadLetter.File)
 	}
-	attrs, err := q.GetQueueAttributes(input)
-	if err != nil {
-		return nil, err
+
+	// result sinks
+	var sn *sns.SNS
+	sinks := make(map[string]ResultSink, len(c.Sinks))
+	for name, sc := range c.Sinks {
+		switch {
+		case sc.QueueName != "" || sc.QueueURL != "":
+			sURL, err := resolveQueueURL(q, c.Account, sc.QueueName, sc.QueueURL)
+			if err != nil {
+				return nil, err
+			}
+			sinks[name] = NewSQSResultSink(q, sURL)
+		case sc.TopicArn != "":
+			if sn == nil {
+				sn = sns.New(sess, awsConf)
+			}
+			sinks[name] = NewSNSResultSink(sn, sc.TopicArn)
+		case sc.URL != "":
+			sinks[name] = NewWebhookResultSink(sc.URL, sc.Headers, sc.Timeout.Duration)
+		case sc.File != "":
+			sinks[name] = NewFileResultSink(sc.File)
+		}
 	}
 
-	// parse a value of message retention period
-	strVal := *attrs.Attributes[sqs.QueueAttributeNameMessageRetentionPeriod]
-	sec, err := strconv.ParseInt(strVal, 10, 64)
-	if err != nil {
-		logger.Errorf("%s", err.Error())
-		return nil, err
+	// local history of job runs
+	var history *History
+	if c.History.Path != "" {
+		h, err := NewHistory(c.History.Path, c.History.MaxAge.Duration, int64(c.History.MaxSize))
+		if err != nil {
+			return nil, err
+		}
+		history = h
 	}
-	rperiod := time.Second * time.Duration(sec)
 
 	return &DefaultSQSJkr{
 		jobs:            make(chan Job),
 		conf:            c,
-		qURL:            qURL,
+		queues:          queues,
 		SQS:             q,
 		RetentionPeriod: rperiod,
+		deadLetter:      dq,
+		resultSink:      sinks[c.Kicker.ResultSink],
+		sinks:           sinks,
+		history:         history,
+		store:           store,
 	}, nil
 }
 
+// NewWithSource build DefaultSQSJkr which runs jobs received from src
+func NewWithSource(c *Config, src MessageSource) *DefaultSQSJkr {
+	return &DefaultSQSJkr{
+		jobs:   make(chan Job),
+		conf:   c,
+		queues: []*queue{newQueue(DefaultQueueName, src, 1, 0)},
+	}
+}
+
+// resolveQueueURL returns qURL if it is specified, otherwise resolves
+// the url of the queue by the queue name.
+func resolveQueueURL(q *sqs.SQS, account AccountSection, name, qURL string) (string, error) {
+	if qURL != "" {
+		return qURL, nil
+	}
+
+	input := &sqs.GetQueueUrlInput{
+		QueueName: aws.String(name),
+	}
+	if account.ID != "" {
+		input.QueueOwnerAWSAccountId = aws.String(account.ID)
+	}
+	out, err := q.GetQueueUrl(input)
+	if err != nil {
+		return "", err
+	}
+	return *out.QueueUrl, nil
+}
+
 // Run SQSJkr daemon
 func Run(ctx context.Context, sjkr SQSJkr, level string) error {
 	logger = NewLogger()
@@ -242,6 +480,9 @@ func Run(ctx context.Context, sjkr SQSJkr, level string) error {
 	stats := &Stats{
 		busy: make(chan struct{}, sjkr.Config().Kicker.MaxConcurrentNum),
 	}
+	if ss, ok := sjkr.(interface{ SetStats(*Stats) }); ok {
+		ss.SetStats(stats)
+	}
 	handlerV1 := func(w http.ResponseWriter, r *http.Request) {
 		busyNum := len(stats.busy)
 		mi := StatsItem{
@@ -263,6 +504,14 @@ func Run(ctx context.Context, sjkr SQSJkr, level string) error {
 		s.Workers.Idle = int64(cap(stats.busy) - busyNum)
 		s.Workers.Busy = int64(busyNum)
 		s.Invocations = stats.Invocations
+		s.Receiver.ConsecutiveFailures = stats.consecutiveFailures()
+		s.Receiver.Status = stats.status()
+		if len(stats.Queues) > 0 {
+			s.Queues = make(map[string]*QueueStats, len(stats.Queues))
+			for name, qs := range stats.Queues {
+				s.Queues[name] = qs.snapshot()
+			}
+		}
 
 		w.Header().Set("Content-type", ApplicationJSON)
 		enc := json.NewEncoder(w)
@@ -272,6 +521,30 @@ func Run(ctx context.Context, sjkr SQSJkr, level string) error {
 		}
 	}
 
+	handlerHealth := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", ApplicationJSON)
+		if !stats.Healthy() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(map[string]string{"status": stats.status()}); err != nil {
+			logger.Errorf(err.Error())
+		}
+	}
+
+	// metrics hook of statsd
+	var sd *StatsD
+	if c := sjkr.Config().Metrics.StatsD; c.Address != "" {
+		var err error
+		if sd, err = NewStatsD(c, stats); err != nil {
+			return err
+		}
+		defer sd.Close()
+		if ah, ok := sjkr.(interface{ AddMetricsHook(MetricsHook) }); ok {
+			ah.AddMetricsHook(sd)
+		}
+	}
+
 	// unix domain or http
 	var l net.Listener
 	var err error
@@ -291,6 +564,15 @@ func Run(ctx context.Context, sjkr SQSJkr, level string) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/stats/metrics/v2", handlerV2)
 	mux.HandleFunc("/stats/metrics", handlerV1)
+	mux.HandleFunc("/stats/health", handlerHealth)
+	prom := NewPrometheus(stats)
+	if ah, ok := sjkr.(interface{ AddMetricsHook(MetricsHook) }); ok {
+		ah.AddMetricsHook(prom)
+	}
+	mux.Handle("/metrics", prom)
+	if hr, ok := sjkr.(interface{ History() *History }); ok && hr.History() != nil {
+		mux.Handle("/jobs/history", historyHandler(hr.History()))
+	}
 
 	srv := &http.Server{Handler: mux}
 	go func() {
@@ -317,6 +599,15 @@ func Run(ctx context.Context, sjkr SQSJkr, level string) error {
 	// context
 	ctx, cancel := context.WithCancel(ctx)
 
+	// push metrics to statsd
+	if sd != nil {
+		go sd.Run(ctx)
+	}
+
+	// jobCtx is canceled to terminate running jobs
+	jobCtx, kill := context.WithCancel(context.Background())
+	defer kill()
+
 	// start sqsjkr daemon
 	wg := new(sync.WaitGroup)
 	wg.Add(1)
@@ -330,21 +621,36 @@ func Run(ctx context.Context, sjkr SQSJkr, level string) error {
 	for i := 0; i < sjkr.Config().Kicker.MaxConcurrentNum; i++ {
 		wg.Add(1)
 		go func(wid int) {
-			SpawnWorker(sjkr, wid, sjkr.JobStream(), stats)
+			spawnWorker(jobCtx, sjkr, wid, sjkr.JobStream(), stats)
 			wg.Done()
 		}(i)
 	}
 
-	// wait for exit signals
+	// wait for exit signals, and stop running jobs if they don't finish
+	// in the grace period.
+	finished := make(chan struct{})
 	go func() {
 		select {
 		case s := <-signalCh:
 			cancel()
 			logger.Infof("signal: %s(%d), shutdown sqsjkr", s, s)
+		case <-ctx.Done():
+		}
+
+		grace := sjkr.Config().Kicker.ShutdownGracePeriod.Duration
+		if grace <= 0 {
+			return
+		}
+		select {
+		case <-finished:
+		case <-time.After(grace):
+			logger.Warnf("grace period %s passed, terminate running jobs", grace)
+			kill()
 		}
 	}()
 
 	wg.Wait()
+	close(finished)
 	srv.Shutdown(ctx)
 	logger.Infof("stopped sqsjkr")
 
@@ -3,6 +3,11 @@ package sqsjkr
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -81,7 +86,7 @@ func (tj TestJob) String() string {
 	return tj.jobID
 }
 
-func (tj TestJob) Execute(locker lock.Locker) ([]byte, error) {
+func (tj TestJob) Execute(ctx context.Context, locker lock.Locker) ([]byte, error) {
 	if tj.jobID == "job-duplicated" {
 		time.Sleep(time.Millisecond * 200)
 	}
@@ -148,3 +153,322 @@ func NewTestJob(id string) Job {
 		jobID: id,
 	}
 }
+
+func TestNewWithEndpoint(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	var actions []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		action := r.Form.Get("Action")
+		actions = append(actions, action)
+		switch action {
+		case "GetQueueUrl":
+			fmt.Fprintf(w, `<GetQueueUrlResponse><GetQueueUrlResult><QueueUrl>http://%s/queue/%s</QueueUrl></GetQueueUrlResult></GetQueueUrlResponse>`,
+				r.Host, r.Form.Get("QueueName"))
+		case "GetQueueAttributes":
+			fmt.Fprint(w, `<GetQueueAttributesResponse><GetQueueAttributesResult><Attribute><Name>MessageRetentionPeriod</Name><Value>345600</Value></Attribute></GetQueueAttributesResult></GetQueueAttributesResponse>`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	conf := NewConfig()
+	conf.SetAWSAccount("123456789", "", "ap-northeast-1")
+	conf.SetSQSQueue("test_queue")
+	conf.SetSQSEndpoint(ts.URL)
+
+	sjkr, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := ts.URL + "/queue/test_queue"; sjkr.Source().(*SQSSource).QueueURL != expect {
+		t.Errorf("unexpected queue url: got=%s, expect=%s", sjkr.Source().(*SQSSource).QueueURL, expect)
+	}
+	if sjkr.RetentionPeriod != 96*time.Hour {
+		t.Errorf("unexpected retention period: got=%s", sjkr.RetentionPeriod)
+	}
+
+	// queue_url is used as is
+	actions = nil
+	conf.SetSQSQueueURL(ts.URL + "/queue/other_queue")
+	sjkr, err = New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qURL := sjkr.Source().(*SQSSource).QueueURL; qURL != ts.URL+"/queue/other_queue" || len(actions) != 1 {
+		t.Errorf("queue url should not be resolved: url=%s actions=%v", qURL, actions)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for n, max := range map[int64]time.Duration{
+		1:   ReceiveBackoffBase,
+		2:   ReceiveBackoffBase * 2,
+		4:   ReceiveBackoffBase * 8,
+		100: ReceiveBackoffMax,
+	} {
+		for i := 0; i < 10; i++ {
+			if d := backoff(n); d < max/2 || d > max {
+				t.Errorf("backoff(%d) should be between %s and %s: got=%s", n, max/2, max, d)
+			}
+		}
+	}
+}
+
+func TestReceiverHealth(t *testing.T) {
+	q := newQueue("test_queue", nil, 1, 0)
+	stats := &Stats{}
+	NewWithSource(NewConfig(), nil).SetStats(stats)
+	stats.Queues[q.name] = q.stats
+
+	q.stats.ConsecutiveFailures = DegradedFailureNum - 1
+	if !stats.Healthy() {
+		t.Errorf("should be healthy after %d failures", DegradedFailureNum-1)
+	}
+	q.stats.ConsecutiveFailures = DegradedFailureNum
+	if stats.Healthy() {
+		t.Errorf("should be degraded after %d failures", DegradedFailureNum)
+	}
+}
+
+func TestReserveWorkers(t *testing.T) {
+	conf := NewConfig()
+	conf.SetConcurrentNum(3)
+	sjkr := NewWithSource(conf, nil)
+	sjkr.sched = newScheduler(3)
+	q := sjkr.queues[0]
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if n := sjkr.reserve(ctx, q, MaxRetrieveMessageNum); n != 3 {
+		t.Errorf("should reserve all idle workers: got=%d, expected=3", n)
+	}
+
+	sjkr.unreserve(q, 1)
+	if n := sjkr.reserve(ctx, q, MaxRetrieveMessageNum); n != 1 {
+		t.Errorf("should reserve a released worker: got=%d, expected=1", n)
+	}
+
+	// no idle worker
+	cancel()
+	if n := sjkr.reserve(ctx, q, MaxRetrieveMessageNum); n != 0 {
+		t.Errorf("should not reserve busy workers: got=%d, expected=0", n)
+	}
+}
+
+func TestReserveWorkersWithQueueLimit(t *testing.T) {
+	conf := NewConfig()
+	conf.SetConcurrentNum(10)
+	sjkr := NewWithSource(conf, nil)
+	sjkr.sched = newScheduler(10)
+	high := newQueue("high", nil, 3, 0)
+	batch := newQueue("batch", nil, 1, 2)
+	sjkr.queues = []*queue{high, batch}
+
+	if n := sjkr.share(high); n != 8 {
+		t.Errorf("unexpected share of high queue: got=%d, expected=8", n)
+	}
+	if n := sjkr.share(batch); n != 2 {
+		t.Errorf("unexpected share of batch queue: got=%d, expected=2", n)
+	}
+
+	ctx := context.Background()
+	if n := sjkr.reserve(ctx, batch, 5); n != 2 {
+		t.Errorf("should reserve workers up to the queue limit: got=%d, expected=2", n)
+	}
+	if n := sjkr.reserve(ctx, high, sjkr.share(high)); n != 8 {
+		t.Errorf("should reserve rest of workers: got=%d, expected=8", n)
+	}
+}
+
+func TestShares(t *testing.T) {
+	for _, c := range []struct {
+		max     int
+		weights []int
+	}{
+		{10, []int{3, 1}},
+		{10, []int{1, 1, 1}},
+		{7, []int{5, 2, 1}},
+		{20, []int{1, 2, 3, 4}},
+	} {
+		conf := NewConfig()
+		conf.SetConcurrentNum(c.max)
+		sjkr := NewWithSource(conf, nil)
+		sjkr.queues = nil
+		for i, w := range c.weights {
+			sjkr.queues = append(sjkr.queues, newQueue(fmt.Sprintf("queue-%d", i), nil, w, 0))
+		}
+		var total int
+		for _, q := range sjkr.queues {
+			total += sjkr.share(q)
+		}
+		if total != c.max {
+			t.Errorf("shares of weights %v should add up to %d: got=%d", c.weights, c.max, total)
+		}
+	}
+}
+
+func TestAssignWorkersByWeight(t *testing.T) {
+	conf := NewConfig()
+	conf.SetConcurrentNum(1)
+	sjkr := NewWithSource(conf, nil)
+	sjkr.sched = newScheduler(1)
+	high := newQueue("high", nil, 3, 0)
+	batch := newQueue("batch", nil, 1, 0)
+	sjkr.queues = []*queue{high, batch}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// each queue waits for the worker to run the next job
+	jobs := make(chan *queue)
+	for _, q := range sjkr.queues {
+		go func(q *queue) {
+			for sjkr.reserve(ctx, q, 1) == 1 {
+				select {
+				case jobs <- q:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(q)
+	}
+	defer cancel()
+
+	assigned := map[*queue]int{}
+	for i := 0; i < 40; i++ {
+		q := <-jobs
+		assigned[q]++
+		for start := time.Now(); ; time.Sleep(time.Millisecond) {
+			sjkr.sched.mu.Lock()
+			waiting := len(sjkr.sched.waiting)
+			sjkr.sched.mu.Unlock()
+			if waiting == 2 {
+				break
+			}
+			if time.Since(start) > time.Second {
+				t.Fatal("queues should wait for the worker")
+			}
+		}
+		// the job finished
+		sjkr.unreserve(q, 1)
+	}
+
+	if h, b := assigned[high], assigned[batch]; h < 29 || b < 9 {
+		t.Errorf("workers should be assigned by weights 3:1: high=%d, batch=%d", h, b)
+	}
+}
+
+func TestCancelReservedWorkers(t *testing.T) {
+	conf := NewConfig()
+	conf.SetConcurrentNum(10)
+	sjkr := NewWithSource(conf, nil)
+	sjkr.sched = newScheduler(10)
+	high := newQueue("high", nil, 3, 0)
+	batch := newQueue("batch", nil, 1, 0)
+	sjkr.queues = []*queue{high, batch}
+	ctx := context.Background()
+
+	// the empty queue doesn't keep workers and its turn
+	n := sjkr.reserve(ctx, high, sjkr.share(high))
+	sjkr.sched.cancel(high, n)
+	if n := sjkr.reserve(ctx, batch, 10); n != 10 {
+		t.Errorf("workers of the empty queue should be released: got=%d, expected=10", n)
+	}
+	if high.pass > batch.pass {
+		t.Errorf("empty queue should not be charged: high=%f, batch=%f", high.pass, batch.pass)
+	}
+}
+
+func TestRunWithFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jobs.jsonl")
+	var lines string
+	for i := 0; i < 3; i++ {
+		lines += fmt.Sprintf(`{"command": "touch %s"}`+"\n", filepath.Join(dir, fmt.Sprintf("done-%d", i)))
+	}
+	if err := ioutil.WriteFile(path, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.SetConcurrentNum(2)
+	conf.SetStatsSocket(filepath.Join(dir, "sqsjkr.sock"))
+	conf.File.Path = path
+	conf.SQS.AtLeastOnce = true
+
+	src := NewFileSource(path, conf.SQS.visibilityTimeout())
+	src.PollInterval = 10 * time.Millisecond
+	sjkr := NewWithSource(conf, src)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, sjkr, "info")
+	}()
+
+	for i := 0; i < 3; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("done-%d", i))
+		for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+			if _, err := os.Stat(name); err == nil {
+				break
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("job was not executed: %s", name)
+			}
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if len(src.inflight) != 0 {
+		t.Errorf("messages should be acked: %v", src.inflight)
+	}
+}
+
+func TestReleaseMessagesOnShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jobs.jsonl")
+	if err := ioutil.WriteFile(path, []byte(`{"command": "true"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.SetConcurrentNum(1)
+	src := NewFileSource(path, time.Minute)
+	sjkr := NewWithSource(conf, src)
+	sjkr.sched = newScheduler(1)
+	sjkr.groups = newGroupQueue(context.Background())
+	q := sjkr.queues[0]
+
+	msgs, err := src.Receive(context.Background(), 1)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("failed to receive message: %v, %s", msgs, err)
+	}
+	q.stats.Received++
+	sjkr.reserve(context.Background(), q, 1)
+
+	// no workers receive the job after shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sjkr.dispatch(ctx, q, msgs[0])
+
+	if fm := src.inflight[msgs[0].ID]; fm == nil || fm.visibleAt.After(time.Now()) {
+		t.Errorf("message should be visible again: %v", fm)
+	}
+	if sjkr.sched.idle != 1 || q.stats.InFlight != 0 {
+		t.Errorf("reserved worker should be released: idle=%d, in_flight=%d", sjkr.sched.idle, q.stats.InFlight)
+	}
+}
@@ -0,0 +1,167 @@
+package sqsjkr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Formats of StatsD metrics
+const (
+	StatsDFormatDogStatsD = "dogstatsd"
+	StatsDFormatStatsD    = "statsd"
+)
+
+var (
+	// statsdNameReplacer replaces characters not allowed in metric names
+	statsdNameReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_")
+	// statsdTagReplacer replaces characters not allowed in tag values
+	statsdTagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
+)
+
+// StatsD pushes metrics to StatsD or DogStatsD over UDP as MetricsHook.
+// Tags are sent only in DogStatsD format.
+type StatsD struct {
+	conn      net.Conn
+	prefix    string
+	tags      []string
+	dogstatsd bool
+	stats     *Stats
+	interval  time.Duration
+}
+
+// NewStatsD build StatsD by the config, which also pushes the workers of
+// stats periodically.
+func NewStatsD(c StatsDSection, stats *Stats) (*StatsD, error) {
+	conn, err := net.Dial("udp", c.Address)
+	if err != nil {
+		return nil, err
+	}
+	s := &StatsD{
+		conn:      conn,
+		prefix:    c.Prefix,
+		tags:      c.Tags,
+		dogstatsd: c.Format != StatsDFormatStatsD,
+		stats:     stats,
+		interval:  c.GaugeInterval.Duration,
+	}
+	if s.prefix == "" {
+		s.prefix = DefaultStatsDPrefix
+	}
+	if s.interval <= 0 {
+		s.interval = DefaultStatsDGaugeInterval
+	}
+	if host, err := os.Hostname(); err == nil {
+		s.tags = append(s.tags[:len(s.tags):len(s.tags)], statsdTag("host", host))
+	}
+	return s, nil
+}
+
+// Run pushes the gauges of workers until ctx is done
+func (s *StatsD) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.pushWorkers()
+		}
+	}
+}
+
+func (s *StatsD) pushWorkers() {
+	if s.stats == nil {
+		return
+	}
+	busy := len(s.stats.busy)
+	s.gauge("workers.busy", int64(busy))
+	s.gauge("workers.idle", int64(cap(s.stats.busy)-busy))
+	if c := cap(s.stats.busy); c > 0 {
+		s.send("workers.utilization", fmt.Sprintf("%g", float64(busy)/float64(c)), "g")
+	}
+}
+
+// Close closes the connection
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+// JobStarted counts the started job and times its queue lag
+func (s *StatsD) JobStarted(ev *JobEvent) {
+	tags := jobTags(ev)
+	s.count("job.started", 1, tags...)
+	if ev.Lag > 0 {
+		s.timing("job.queue_lag", ev.Lag, tags...)
+	}
+}
+
+// JobFinished counts the outcome of the job and times its duration
+func (s *StatsD) JobFinished(ev *JobEvent) {
+	tags := append(jobTags(ev), statsdTag("outcome", ev.Outcome))
+	s.count("job.finished", 1, tags...)
+	s.timing("job.duration", ev.Elapsed, tags...)
+	if ev.LockWait > 0 {
+		s.timing("job.lock_wait", ev.LockWait, jobTags(ev)...)
+	}
+}
+
+// JobDuplicated counts the duplicated job
+func (s *StatsD) JobDuplicated(ev *JobEvent) {
+	s.count("job.duplicated", 1, jobTags(ev)...)
+}
+
+// MessagesReceived counts the receive and the received messages
+func (s *StatsD) MessagesReceived(queue string, n int) {
+	s.count("receive.batches", 1, statsdTag("queue", queue))
+	s.count("receive.messages", int64(n), statsdTag("queue", queue))
+}
+
+// SourceFailed counts the failed operation of the queue
+func (s *StatsD) SourceFailed(queue, operation string, err error) {
+	s.count("sqs.errors", 1, statsdTag("queue", queue), statsdTag("operation", operation))
+}
+
+func jobTags(ev *JobEvent) []string {
+	tags := []string{statsdTag("event_id", metricEventID(ev.Job))}
+	if ev.Queue != "" {
+		tags = append(tags, statsdTag("queue", ev.Queue))
+	}
+	return tags
+}
+
+// statsdTag formats the tag of DogStatsD
+func statsdTag(key, value string) string {
+	return key + ":" + statsdTagReplacer.Replace(value)
+}
+
+func (s *StatsD) count(name string, n int64, tags ...string) {
+	s.send(name, fmt.Sprintf("%d", n), "c", tags...)
+}
+
+func (s *StatsD) gauge(name string, n int64, tags ...string) {
+	s.send(name, fmt.Sprintf("%d", n), "g", tags...)
+}
+
+func (s *StatsD) timing(name string, d time.Duration, tags ...string) {
+	s.send(name, fmt.Sprintf("%g", float64(d)/float64(time.Millisecond)), "ms", tags...)
+}
+
+// send sends the metric in a datagram. Errors are ignored since metrics
+// are best effort.
+func (s *StatsD) send(name, value, typ string, tags ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s:%s|%s", s.prefix, statsdNameReplacer.Replace(name), value, typ)
+	if s.dogstatsd {
+		if all := append(s.tags[:len(s.tags):len(s.tags)], tags...); len(all) > 0 {
+			fmt.Fprintf(&b, "|#%s", strings.Join(all, ","))
+		}
+	}
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		logger.Debugf("failed to send metric to statsd: %s", err)
+	}
+}
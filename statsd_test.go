@@ -0,0 +1,91 @@
+package sqsjkr
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenStatsD(t *testing.T) (*net.UDPConn, func() []string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() []string {
+		var lines []string
+		buf := make([]byte, 1024)
+		for {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, err := conn.Read(buf)
+			if err != nil {
+				return lines
+			}
+			lines = append(lines, string(buf[:n]))
+		}
+	}
+	return conn, read
+}
+
+func TestStatsD(t *testing.T) {
+	conn, read := listenStatsD(t)
+	defer conn.Close()
+
+	s, err := NewStatsD(StatsDSection{Address: conn.LocalAddr().String(), Tags: []string{"env:test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.tags = s.tags[:1] // without host
+
+	job := &DefaultJob{jobID: "msg-1", eventID: "batch|daily"}
+	s.JobStarted(&JobEvent{Job: job, Queue: "q1", Lag: 1500 * time.Millisecond})
+	s.JobFinished(&JobEvent{Job: job, Queue: "q1", Outcome: OutcomeSucceeded, Elapsed: 2 * time.Second})
+	s.MessagesReceived("q1", 3)
+	s.SourceFailed("q1", OperationDelete, errors.New("throttled"))
+	// event_id of the message ID is not tagged
+	s.JobStarted(&JobEvent{Job: &DefaultJob{jobID: "msg-2", eventID: "msg-2"}, Queue: "q1"})
+
+	expected := []string{
+		"sqsjkr.job.started:1|c|#env:test,event_id:batch_daily,queue:q1",
+		"sqsjkr.job.queue_lag:1500|ms|#env:test,event_id:batch_daily,queue:q1",
+		"sqsjkr.job.finished:1|c|#env:test,event_id:batch_daily,queue:q1,outcome:succeeded",
+		"sqsjkr.job.duration:2000|ms|#env:test,event_id:batch_daily,queue:q1,outcome:succeeded",
+		"sqsjkr.receive.batches:1|c|#env:test,queue:q1",
+		"sqsjkr.receive.messages:3|c|#env:test,queue:q1",
+		"sqsjkr.sqs.errors:1|c|#env:test,queue:q1,operation:delete",
+		"sqsjkr.job.started:1|c|#env:test,event_id:unknown,queue:q1",
+	}
+	if lines := read(); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected metrics:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestStatsDWorkers(t *testing.T) {
+	conn, read := listenStatsD(t)
+	defer conn.Close()
+
+	stats := &Stats{busy: make(chan struct{}, 4)}
+	stats.busy <- struct{}{}
+	s, err := NewStatsD(StatsDSection{
+		Address:       conn.LocalAddr().String(),
+		Prefix:        "app.",
+		Format:        StatsDFormatStatsD,
+		GaugeInterval: Duration{10 * time.Millisecond},
+	}, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	lines := read()
+	if len(lines) < 3 || lines[0] != "app.workers.busy:1|g" || lines[1] != "app.workers.idle:3|g" || lines[2] != "app.workers.utilization:0.25|g" {
+		t.Errorf("unexpected metrics:\n%s", strings.Join(lines, "\n"))
+	}
+}
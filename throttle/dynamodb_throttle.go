@@ -150,6 +150,11 @@ func (dt *DynamodbThrottle) GetWriteCapacity() (int64, error) {
 
 // NewDynamodbThrottle build DynamodbThrottle
 func NewDynamodbThrottle(ctx context.Context, profile, region, table string, retention time.Duration) Throttler {
+	return NewDynamodbThrottleWithEndpoint(ctx, profile, region, "", table, retention)
+}
+
+// NewDynamodbThrottleWithEndpoint build DynamodbThrottle which uses the DynamoDB endpoint
+func NewDynamodbThrottleWithEndpoint(ctx context.Context, profile, region, endpoint, table string, retention time.Duration) Throttler {
 	var conf *aws.Config
 	if profile != "" {
 		conf = &aws.Config{
@@ -161,6 +166,9 @@ func NewDynamodbThrottle(ctx context.Context, profile, region, table string, ret
 			Region: aws.String(region),
 		}
 	}
+	if endpoint != "" {
+		conf.Endpoint = aws.String(endpoint)
+	}
 
 	// configure Dynamodb
 	ddb := dynamodb.New(session.New(), conf)
@@ -1,13 +1,17 @@
 package sqsjkr
 
 import (
+	"context"
+	"errors"
 	"sync/atomic"
+	"time"
 
 	"github.com/kayac/sqsjkr/throttle"
 )
 
 // Worker struct
 type Worker struct {
+	ctx   context.Context
 	sjkr  SQSJkr
 	id    int
 	jobs  <-chan Job
@@ -16,11 +20,17 @@ type Worker struct {
 
 // SpawnWorker spawn worker
 func SpawnWorker(sjkr SQSJkr, wid int, js <-chan Job, s *Stats) {
+	spawnWorker(context.Background(), sjkr, wid, js, s)
+}
+
+// spawnWorker spawn worker which terminates running jobs when ctx is done
+func spawnWorker(ctx context.Context, sjkr SQSJkr, wid int, js <-chan Job, s *Stats) {
 	defer func(id int) {
 		logger.Infof("[worker_id:%d] terminated command worker.", wid)
 	}(wid)
 
 	worker := Worker{
+		ctx:   ctx,
 		sjkr:  sjkr,
 		id:    wid,
 		jobs:  js,
@@ -35,25 +45,108 @@ func SpawnWorker(sjkr SQSJkr, wid int, js <-chan Job, s *Stats) {
 func (w Worker) ReceiveMessage() {
 	// worker will be killed when errCnt is over 5.
 	for job := range w.jobs {
-		if err := w.sjkr.Throttler().Set(job.JobID()); err != nil {
-			if err == throttle.ErrDuplicatedMessage {
-				logger.Errorf("duplicated message id: %s", job.JobID())
-				continue
-			}
-			logger.Errorf("reason=%s ,job=%v", err.Error(), job)
+		// runs the jobs of the same message group one after another
+		for ; job != nil; job = next(job) {
+			w.runJob(job)
 		}
+	}
+
+	logger.Infof("[worker_id:%d] terminating", w.id)
+	return
+}
 
-		if err := w.executeJob(job); err != nil {
-			logger.Errorf("[worker_id:%d] execute job failed %s", w.id, err.Error())
+func (w Worker) runJob(job Job) {
+	if err := w.sjkr.Throttler().Set(job.JobID()); err != nil {
+		if err == throttle.ErrDuplicatedMessage {
+			logger.Errorf("duplicated message id: %s", job.JobID())
+			w.metrics().JobDuplicated(newJobEvent(job))
+			w.acknowledge(job, nil, err)
+			return
 		}
+		logger.Errorf("reason=%s ,job=%v", err.Error(), job)
+	}
 
+	started := time.Now()
+	output, err := w.executeJob(job)
+	if err != nil {
+		logger.Errorf("[worker_id:%d] execute job failed %s", w.id, err.Error())
 	}
+	jr := newJobResult(job, output, err, started, time.Now())
+	w.publishResult(jr, replyTo(job))
+	w.recordHistory(newHistoryRecord(job, jr, output))
+	w.acknowledge(job, output, err)
+	if err == nil {
+		w.deletePayload(job)
+	}
+}
 
-	logger.Infof("[worker_id:%d] terminating", w.id)
-	return
+// deletePayload deletes the payload of the succeeded job from the object store.
+func (w Worker) deletePayload(job Job) {
+	d, ok := job.(interface{ DeletePayload() error })
+	if !ok {
+		return
+	}
+	if err := d.DeletePayload(); err != nil {
+		logger.Errorf("[event:%s] failed to delete payload, reason: %s", job.EventID(), err.Error())
+	}
+}
+
+// publishResult sends the result of the job to the result sinks of SQSJkr
+// and the sink which the message replies to.
+func (w Worker) publishResult(jr *JobResult, replyTo string) {
+	rs, ok := w.sjkr.(interface {
+		ResultSinks(replyTo string) ([]ResultSink, error)
+	})
+	if !ok {
+		return
+	}
+	sinks, err := rs.ResultSinks(replyTo)
+	if err != nil {
+		logger.Errorf("[event:%s] failed to reply result, reason: %s", jr.EventID, err.Error())
+	}
+	for _, s := range sinks {
+		if serr := s.Send(jr); serr != nil {
+			logger.Errorf("[event:%s] failed to send result, reason: %s", jr.EventID, serr.Error())
+		}
+	}
+}
+
+// recordHistory adds the record of the job run to History of SQSJkr.
+func (w Worker) recordHistory(rec *HistoryRecord) {
+	hr, ok := w.sjkr.(interface{ History() *History })
+	if !ok || hr.History() == nil {
+		return
+	}
+	if err := hr.History().Add(rec); err != nil {
+		logger.Errorf("[event:%s] failed to record history, reason: %s", rec.EventID, err.Error())
+	}
+}
+
+// replyTo returns reply_to of the job's message.
+func replyTo(job Job) string {
+	if r, ok := job.(interface{ ReplyTo() string }); ok {
+		return r.ReplyTo()
+	}
+	return ""
+}
+
+// metrics returns MetricsHook of SQSJkr
+func (w Worker) metrics() MetricsHook {
+	if m, ok := w.sjkr.(interface{ MetricsHook() MetricsHook }); ok {
+		return m.MetricsHook()
+	}
+	return metricsHooks(nil)
+}
+
+// next returns the job which waits for job in the same message group.
+func next(job Job) Job {
+	if s, ok := job.(interface{ Next() Job }); ok {
+		return s.Next()
+	}
+	return nil
 }
 
-func (w Worker) executeJob(job Job) error {
+func (w Worker) executeJob(job Job) ([]byte, error) {
 	// busy worker number count up
 	w.stats.busy <- struct{}{}
 
@@ -62,22 +155,211 @@ func (w Worker) executeJob(job Job) error {
 		<-w.stats.busy
 	}()
 
+	// keep the message of the job invisible while running. The heartbeat
+	// stops before the message is acknowledged, not to override it.
+	if hb, ok := job.(Heartbeater); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			hb.Heartbeat(ctx)
+			close(stopped)
+		}()
+		defer func() {
+			cancel()
+			<-stopped
+		}()
+	}
+
 	// Execute job
-	logger.Infof("CMD event_id:%s command:%s", job.EventID(), job.Command())
-	output, err := job.Execute(w.sjkr.Locker())
-	if err != nil && output == nil {
-		atomic.AddInt64(&w.stats.Invocations.Failed, 1)
+	var metadata string
+	if m, ok := job.(interface{ Metadata() map[string]string }); ok {
+		metadata = formatMetadata(m.Metadata())
+	}
+	logger.Infof("CMD event_id:%s command:%s%s", job.EventID(), job.Command(), metadata)
+	ev := newJobEvent(job)
+	w.metrics().JobStarted(ev)
+	started := time.Now()
+	output, err := job.Execute(w.ctx, w.sjkr.Locker())
+	ev.Outcome = outcomeOf(output, err)
+	ev.Elapsed = time.Since(started)
+	if l, ok := job.(interface{ LockWait() time.Duration }); ok {
+		ev.LockWait = l.LockWait()
+	}
+	w.metrics().JobFinished(ev)
+	if r := result(job); r != nil && r.Truncated() {
+		logger.Warnf("[event:%s] output truncated, %d of %d bytes are dropped", job.EventID(), r.Output.Truncated(), r.Output.Size())
+	}
+	if errors.Is(err, ErrTimedOut) {
+		w.countInvocation(job, OutcomeTimedOut)
+		logger.Errorf("[event:%s] timed out to invoke command, reason: %s, job: %s", job.EventID(), err.Error(), job.String())
+		return output, err
+	} else if errors.Is(err, ErrLimitExceeded) {
+		w.countInvocation(job, OutcomeLimitExceeded)
+		logger.Errorf("[event:%s] exceeded resource limit, reason: %s, job: %s", job.EventID(), err.Error(), job.String())
+		return output, err
+	} else if err != nil && output == nil {
+		w.countInvocation(job, OutcomeFailed)
 		logger.Errorf("[event:%s] failed to invoke command, reason: %s, job: %s", job.EventID(), err.Error(), job.String())
-		return err
+		return nil, err
 	} else if err != nil {
-		atomic.AddInt64(&w.stats.Invocations.Errored, 1)
+		w.countInvocation(job, OutcomeErrored)
 		logger.Errorf("[event:%s] errored to invoke command, reason: %s, job: %s", job.EventID(), err.Error(), job.String())
-		logger.Errorf(string(output))
-		return err
-	} else {
-		atomic.AddInt64(&w.stats.Invocations.Succeeded, 1)
+		return output, err
 	}
-	logger.Debugf("[event:%s] output:\n%s", job.EventID(), string(output))
+	w.countInvocation(job, OutcomeSucceeded)
 
+	return output, nil
+}
+
+// result returns the output of the executed job if the job keeps it.
+func result(job Job) *Result {
+	if r, ok := job.(interface{ Result() *Result }); ok {
+		return r.Result()
+	}
 	return nil
 }
+
+// countInvocation counts up invocations of the outcome, and also counts up
+// the stats of the queue which the job came from.
+func (w Worker) countInvocation(job Job, outcome string) {
+	switch outcome {
+	case OutcomeSucceeded:
+		atomic.AddInt64(&w.stats.Invocations.Succeeded, 1)
+	case OutcomeFailed:
+		atomic.AddInt64(&w.stats.Invocations.Failed, 1)
+	case OutcomeErrored:
+		atomic.AddInt64(&w.stats.Invocations.Errored, 1)
+	case OutcomeTimedOut:
+		atomic.AddInt64(&w.stats.Invocations.TimedOut, 1)
+	case OutcomeLimitExceeded:
+		atomic.AddInt64(&w.stats.Invocations.LimitExceeded, 1)
+	}
+
+	q, ok := job.(interface{ QueueStats() *QueueStats })
+	if !ok {
+		return
+	}
+	switch outcome {
+	case OutcomeSucceeded:
+		atomic.AddInt64(&q.QueueStats().Succeeded, 1)
+	case OutcomeFailed:
+		atomic.AddInt64(&q.QueueStats().Failed, 1)
+	case OutcomeErrored:
+		atomic.AddInt64(&q.QueueStats().Errored, 1)
+	case OutcomeTimedOut:
+		atomic.AddInt64(&q.QueueStats().TimedOut, 1)
+	case OutcomeLimitExceeded:
+		atomic.AddInt64(&q.QueueStats().LimitExceeded, 1)
+	}
+}
+
+// acknowledge reports the result of job to the queue if the job is an
+// Acknowledger. The job's message is completed when the job succeeded or
+// ended with a terminal error, otherwise it is left to be redelivered and
+// acknowledge returns true. The failed job is sent to the dead letter queue
+// before its message is completed, and the message is left to be
+// redelivered if the dead letter could not be sent.
+func (w Worker) acknowledge(job Job, output []byte, err error) bool {
+	ack, ok := job.(Acknowledger)
+	if !ok {
+		if deadLettered(err) {
+			w.forwardDeadLetter(job, output, err)
+		}
+		return false
+	}
+
+	// the job terminated by shutdown runs again regardless of its retry
+	// policy.
+	if r, ok := job.(interface{ Release() error }); ok && err != nil && w.killed() && ack.Redeliverable() {
+		if uerr := w.sjkr.Throttler().Unset(job.JobID()); uerr != nil {
+			logger.Errorf("[event:%s] failed to unset throttle, reason: %s", job.EventID(), uerr.Error())
+		}
+		if rerr := r.Release(); rerr != nil {
+			logger.Errorf("[event:%s] failed to release message, reason: %s", job.EventID(), rerr.Error())
+		}
+		logger.Infof("[event:%s] released message of the job terminated by shutdown", job.EventID())
+		return true
+	}
+
+	if err == nil || isTerminal(err) || !ack.Redeliverable() || !retryable(job, err) {
+		if deadLettered(err) {
+			if derr := w.forwardDeadLetter(job, output, err); derr != nil && ack.Redeliverable() {
+				// the message is not deleted to send it again
+				w.redeliver(job, ack)
+				return true
+			}
+		}
+		if aerr := ack.Ack(); aerr != nil {
+			logger.Errorf("[event:%s] failed to ack message, reason: %s", job.EventID(), aerr.Error())
+		}
+		return false
+	}
+
+	w.redeliver(job, ack)
+	return true
+}
+
+// redeliver leaves the message of the job to be redelivered.
+func (w Worker) redeliver(job Job, ack Acknowledger) {
+
+	// the redelivered message has the same job id, so allows it to run again.
+	if uerr := w.sjkr.Throttler().Unset(job.JobID()); uerr != nil {
+		logger.Errorf("[event:%s] failed to unset throttle, reason: %s", job.EventID(), uerr.Error())
+	}
+	if nerr := ack.Nack(); nerr != nil {
+		logger.Errorf("[event:%s] failed to nack message, reason: %s", job.EventID(), nerr.Error())
+	}
+}
+
+// killed reports whether running jobs of the worker have been terminated.
+func (w Worker) killed() bool {
+	return w.ctx != nil && w.ctx.Err() != nil
+}
+
+// deadLettered reports whether the job completed by err is sent to the dead
+// letter queue. The job skipped by the lock or the throttler is not failed.
+func deadLettered(err error) bool {
+	return err != nil && !errors.Is(err, ErrLocked) && err != throttle.ErrDuplicatedMessage
+}
+
+// forwardDeadLetter sends the failed job to the dead letter queue if
+// SQSJkr has DeadLetterQueue.
+func (w Worker) forwardDeadLetter(job Job, output []byte, err error) error {
+	dqr, ok := w.sjkr.(interface{ DeadLetterQueue() DeadLetterQueue })
+	if !ok || dqr.DeadLetterQueue() == nil {
+		return nil
+	}
+
+	var msg *Message
+	if m, ok := job.(interface{ Message() *Message }); ok {
+		msg = m.Message()
+	}
+
+	dl := newDeadLetter(msg, outcomeOf(output, err), err)
+	dl.MessageID = job.JobID()
+	dl.EventID = job.EventID()
+	dl.setOutput(output, err)
+	if r := result(job); r != nil && r.Truncated() {
+		dl.OutputTruncated = true
+	}
+
+	derr := dqr.DeadLetterQueue().Send(dl)
+	if derr != nil {
+		logger.Errorf("[event:%s] failed to send dead letter, reason: %s", job.EventID(), derr.Error())
+	}
+	return derr
+}
+
+// retryable reports whether the job failed by err should be retried by its
+// retry policy.
+func retryable(job Job, err error) bool {
+	r, ok := job.(interface{ Retryable(error) bool })
+	return !ok || r.Retryable(err)
+}
+
+// isTerminal reports whether err is the result which never changes by retrying.
+func isTerminal(err error) bool {
+	return errors.Is(err, ErrOverLifeTime) ||
+		errors.Is(err, ErrLocked) ||
+		err == throttle.ErrDuplicatedMessage
+}
@@ -0,0 +1,264 @@
+package sqsjkr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kayac/sqsjkr/lock"
+)
+
+type AckTestJob struct {
+	TestJob
+	err    error
+	acked  bool
+	nacked bool
+}
+
+func (aj *AckTestJob) Execute(ctx context.Context, locker lock.Locker) ([]byte, error) {
+	return []byte("ok"), aj.err
+}
+
+func (aj *AckTestJob) Ack() error {
+	aj.acked = true
+	return nil
+}
+
+func (aj *AckTestJob) Nack() error {
+	aj.nacked = true
+	return nil
+}
+
+func (aj *AckTestJob) Redeliverable() bool {
+	return true
+}
+
+func TestAcknowledge(t *testing.T) {
+	w := Worker{
+		ctx: context.Background(),
+		sjkr: TestSQSJkr{
+			throttler: &TestThrottle{table: map[string]bool{}},
+		},
+		stats: &Stats{busy: make(chan struct{}, 1)},
+	}
+
+	cases := []struct {
+		err  error
+		ack  bool
+		nack bool
+	}{
+		{err: nil, ack: true},
+		{err: ErrOverLifeTime, ack: true},
+		{err: ErrLocked, ack: true},
+		{err: errors.New("exit status 1"), nack: true},
+	}
+
+	for _, c := range cases {
+		job := &AckTestJob{TestJob: TestJob{jobID: "ack-job"}, err: c.err}
+		_, err := w.executeJob(job)
+		w.acknowledge(job, nil, err)
+		if job.acked != c.ack || job.nacked != c.nack {
+			t.Errorf("unexpected ack for err=%v: acked=%t nacked=%t", c.err, job.acked, job.nacked)
+		}
+	}
+}
+
+type DeadLetterTestSQSJkr struct {
+	TestSQSJkr
+	dq DeadLetterQueue
+}
+
+func (dsjkr DeadLetterTestSQSJkr) DeadLetterQueue() DeadLetterQueue {
+	return dsjkr.dq
+}
+
+func TestForwardDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead_letter.jsonl")
+
+	w := Worker{
+		ctx: context.Background(),
+		sjkr: DeadLetterTestSQSJkr{
+			TestSQSJkr: TestSQSJkr{throttler: &TestThrottle{table: map[string]bool{}}},
+			dq:         NewFileDeadLetterQueue(path),
+		},
+		stats: &Stats{busy: make(chan struct{}, 1)},
+	}
+
+	body := `{"command": "echo failed; exit 3", "event_id": "dead_letter_event"}`
+	job, err := NewJob(buildMsg(body), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := w.executeJob(job)
+	if err == nil {
+		t.Fatal("job should be errored")
+	}
+	w.forwardDeadLetter(job, output, err)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dl DeadLetter
+	if err := json.Unmarshal(b, &dl); err != nil {
+		t.Fatal(err)
+	}
+	if dl.Body != body || dl.EventID != "dead_letter_event" || dl.Outcome != OutcomeErrored {
+		t.Errorf("unexpected dead letter: %#v", dl)
+	}
+	if dl.ExitCode != 3 || dl.Output != "failed\n" {
+		t.Errorf("unexpected exit code or output: exit_code=%d output=%q", dl.ExitCode, dl.Output)
+	}
+}
+
+func TestReleaseKilledJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jobs.jsonl")
+	body := `{"command": "sleep 10", "max_retries": 3, "retry_on_exit_codes": [3]}`
+	if err := ioutil.WriteFile(path, []byte(body+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dlPath := filepath.Join(dir, "dead_letter.jsonl")
+
+	conf := NewConfig()
+	conf.SetConcurrentNum(1)
+	conf.Kicker.KillTimeout.Duration = 100 * time.Millisecond
+	src := NewFileSource(path, time.Minute)
+	sjkr := NewWithSource(conf, src)
+	sjkr.SetThrottler(&TestThrottle{table: map[string]bool{}})
+	sjkr.SetDeadLetterQueue(NewFileDeadLetterQueue(dlPath))
+	sjkr.sched = newScheduler(1)
+	sjkr.groups = newGroupQueue(context.Background())
+	q := sjkr.queues[0]
+
+	// the grace period passed while the job is running
+	ctx, kill := context.WithCancel(context.Background())
+	stats := &Stats{busy: make(chan struct{}, 1)}
+	done := make(chan struct{})
+	go func() {
+		spawnWorker(ctx, sjkr, 0, sjkr.jobs, stats)
+		close(done)
+	}()
+	msgs, err := src.Receive(context.Background(), 1)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("failed to receive message: %v, %s", msgs, err)
+	}
+	sjkr.reserve(context.Background(), q, 1)
+	sjkr.dispatch(context.Background(), q, msgs[0])
+	time.Sleep(200 * time.Millisecond)
+	kill()
+	close(sjkr.jobs)
+	<-done
+
+	if fm := src.inflight[msgs[0].ID]; fm == nil || fm.visibleAt.After(time.Now()) {
+		t.Errorf("message of the killed job should be visible again: %v", fm)
+	}
+	if _, err := os.Stat(dlPath); !os.IsNotExist(err) {
+		t.Errorf("killed job should not be sent to dead letter: %v", err)
+	}
+	if sjkr.sched.idle != 1 {
+		t.Errorf("worker should be released: idle=%d", sjkr.sched.idle)
+	}
+}
+
+type FailingDeadLetterQueue struct{}
+
+func (dq FailingDeadLetterQueue) Send(dl *DeadLetter) error {
+	return errors.New("throttled")
+}
+
+func TestKeepMessageIfDeadLetterFailed(t *testing.T) {
+	w := Worker{
+		ctx: context.Background(),
+		sjkr: DeadLetterTestSQSJkr{
+			TestSQSJkr: TestSQSJkr{throttler: &TestThrottle{table: map[string]bool{}}},
+			dq:         FailingDeadLetterQueue{},
+		},
+		stats: &Stats{busy: make(chan struct{}, 1)},
+	}
+
+	job := &AckTestJob{TestJob: TestJob{jobID: "dead-letter-job"}, err: ErrOverLifeTime}
+	_, err := w.executeJob(job)
+	if !w.acknowledge(job, nil, err) {
+		t.Error("message should be redelivered")
+	}
+	if job.acked || !job.nacked {
+		t.Errorf("message should not be deleted: acked=%t nacked=%t", job.acked, job.nacked)
+	}
+}
+
+func TestKeepDiscardedMessageIfDeadLetterFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqsjkr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jobs.jsonl")
+	if err := ioutil.WriteFile(path, []byte("not json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := NewFileSource(path, time.Minute)
+	sjkr := NewWithSource(NewConfig(), src)
+	sjkr.SetDeadLetterQueue(FailingDeadLetterQueue{})
+	sjkr.sched = newScheduler(1)
+	sjkr.groups = newGroupQueue(context.Background())
+	q := sjkr.queues[0]
+
+	msgs, err := src.Receive(context.Background(), 1)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("failed to receive message: %v, %s", msgs, err)
+	}
+	sjkr.reserve(context.Background(), q, 1)
+	sjkr.dispatch(context.Background(), q, msgs[0])
+
+	if src.inflight[msgs[0].ReceiptHandle] == nil {
+		t.Error("invalid message should not be deleted")
+	}
+	if sjkr.sched.idle != 1 {
+		t.Errorf("worker should be released: idle=%d", sjkr.sched.idle)
+	}
+}
+
+type HeartbeatTestJob struct {
+	TestJob
+	stopped chan struct{}
+}
+
+func (hj *HeartbeatTestJob) Heartbeat(ctx context.Context) {
+	<-ctx.Done()
+	// the tick running when the job finished
+	time.Sleep(50 * time.Millisecond)
+	close(hj.stopped)
+}
+
+func TestWaitHeartbeatStopped(t *testing.T) {
+	w := Worker{
+		ctx:   context.Background(),
+		sjkr:  TestSQSJkr{throttler: &TestThrottle{table: map[string]bool{}}},
+		stats: &Stats{busy: make(chan struct{}, 1)},
+	}
+	job := &HeartbeatTestJob{TestJob: TestJob{jobID: "heartbeat-job"}, stopped: make(chan struct{})}
+	w.executeJob(job)
+
+	select {
+	case <-job.stopped:
+	default:
+		t.Error("heartbeat should stop before the job is acknowledged")
+	}
+}